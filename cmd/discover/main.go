@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/nguba/RedLionPXU/internal/device"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	var (
+		port     = flag.String("port", "COM3", "Serial port (default: COM3)")
+		urlF     = flag.String("url", "", "Connection URL overriding -port, e.g. tcp://gateway:502")
+		bauds    = flag.String("bauds", "", "Comma separated baud rates to try (default: 38400,19200,9600,4800,2400,1200)")
+		parities = flag.String("parities", "", "Comma separated parities to try (default: none,even,odd)")
+		units    = flag.String("units", "", "Unit Ids to probe, e.g. 1-10,42 (default: 1-247)")
+		timeout  = flag.Duration("timeout", device.DefaultProbeTimeout, "How long each unit gets to answer, on top of the time the probe takes on the wire")
+	)
+
+	flag.Parse()
+
+	opts := device.DiscoveryOptions{
+		URL:          fmt.Sprintf("rtu://%s", *port),
+		ProbeTimeout: *timeout,
+	}
+	if *urlF != "" {
+		opts.URL = *urlF
+	}
+
+	var err error
+	if opts.BaudRates, err = parseBauds(*bauds); err != nil {
+		log.Fatal(err)
+	}
+	if *parities != "" {
+		opts.Parities = strings.Split(*parities, ",")
+	}
+	if opts.UnitIds, err = parseUnits(*units); err != nil {
+		log.Fatal(err)
+	}
+
+	// Ctrl-C ends the sweep early
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	found, err := device.Discover(ctx, opts)
+	if err != nil {
+		log.Printf("discovery ended early: %v", err)
+	}
+	for _, d := range found {
+		fmt.Println(d)
+	}
+	fmt.Printf("found %d controller(s)\n", len(found))
+}
+
+func parseBauds(bauds string) ([]uint, error) {
+	if bauds == "" {
+		return nil, nil
+	}
+
+	var speeds []uint
+	for _, s := range strings.Split(bauds, ",") {
+		speed, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+		if err != nil || speed == 0 {
+			return nil, fmt.Errorf("invalid baud rate %q", s)
+		}
+		speeds = append(speeds, uint(speed))
+	}
+	return speeds, nil
+}
+
+// parseUnits reads a list of unit Ids and ranges, e.g. 1-10,42.
+func parseUnits(units string) ([]device.UnitId, error) {
+	if units == "" {
+		return nil, nil
+	}
+
+	var ids []device.UnitId
+	for _, s := range strings.Split(units, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(s), "-")
+		if !isRange {
+			last = first
+		}
+
+		from, err1 := strconv.ParseUint(first, 10, 8)
+		to, err2 := strconv.ParseUint(last, 10, 8)
+		if err1 != nil || err2 != nil || from < device.MinUnitId || to > device.MaxUnitId || from > to {
+			return nil, fmt.Errorf("invalid unit ids %q", s)
+		}
+		for id := from; id <= to; id++ {
+			ids = append(ids, device.UnitId(id))
+		}
+	}
+	return ids, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/nguba/RedLionPXU/internal/device"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,20 +14,40 @@ func main() {
 	var (
 		unitId = flag.Uint("unit", 6, "Modbus unit ID (default: 6)")
 		port   = flag.String("port", "COM3", "Serial port (default: COM3)")
+		urlF   = flag.String("url", "", "Connection URL overriding -port, e.g. tcp://gateway:502 or rtuovertcp://gateway:4001")
+		parity = flag.String("parity", "none", "Serial parity: none, even or odd")
 		infoF  = flag.Bool("info", false, "Print device information")
 		statsF = flag.Bool("stats", false, "Print device statistics")
 		profF  = flag.Bool("profile", false, "Read the profile")
+		alarmF = flag.Bool("alarms", false, "Print the alarm configuration and state")
+		resetF = flag.Bool("reset-alarms", false, "Reset the latched alarms")
+		outF   = flag.String("output", "", "Set the output power in percent in manual mode, or auto to return to the control loop")
+		regsF  = flag.Bool("registers", false, "List the known registers")
+		getF   = flag.String("get", "", "Read a register by name, e.g. sp or link[3]")
+		setF   = flag.String("set", "", "Write a register by name, e.g. sp=65.5")
 	)
 
 	flag.Parse()
 
+	if *regsF {
+		for _, r := range device.RegisterMap {
+			fmt.Println(r)
+		}
+		return
+	}
+
 	// this should represent the communication settings of the device used.
 	cfg := &device.Configuration{
 		URL:      fmt.Sprintf("rtu://%s", *port),
 		Speed:    38400,
 		DataBits: 8,
-		Parity:   "none",
-		Timeout:  500 * time.Millisecond,
+		Parity:   *parity,
+	}
+	if *urlF != "" {
+		cfg.URL = *urlF
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid connection settings: %v", err)
 	}
 
 	client, err := device.NewModbusDevice(cfg)
@@ -45,18 +67,77 @@ func main() {
 		}
 	}(pxu)
 
+	if _, err := pxu.ReadScale(); err != nil {
+		log.Fatalf("Failed to read input configuration: %v", err)
+	}
+
 	if infoF != nil && *infoF {
 		info, err := pxu.ReadInfo()
 		if err != nil {
 			log.Fatalf("Failed to read info: %v", err)
 		}
 		fmt.Println(info)
+
+		caps, err := device.NewCapabilities(*info)
+		if err != nil {
+			log.Printf("Unknown capabilities: %v", err)
+		} else {
+			fmt.Println(caps)
+		}
 	}
 
 	if statsF != nil && *statsF {
 		showStats(pxu)
 	}
 
+	if *resetF {
+		if err := pxu.ResetAlarms(); err != nil {
+			log.Fatalf("Failed to reset alarms: %v", err)
+		}
+	}
+
+	if *alarmF {
+		for i := uint16(0); i < device.AlarmCount; i++ {
+			alarm, err := pxu.ReadAlarm(i)
+			if err != nil {
+				log.Fatalf("Failed to read alarm: %v", err)
+			}
+			fmt.Println(alarm)
+		}
+
+		status, err := pxu.ReadAlarmStatus()
+		if err != nil {
+			log.Fatalf("Failed to read alarm status: %v", err)
+		}
+		fmt.Println(status)
+	}
+
+	if *outF != "" {
+		setOutput(pxu, *outF)
+		return
+	}
+
+	if *getF != "" {
+		val, err := pxu.Get(*getF)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *getF, err)
+		}
+		fmt.Printf("%s = %v\n", *getF, val)
+		return
+	}
+
+	if *setF != "" {
+		name, raw, ok := strings.Cut(*setF, "=")
+		val, err := strconv.ParseFloat(raw, 64)
+		if !ok || err != nil {
+			log.Fatalf("Invalid assignment %q, expected name=value", *setF)
+		}
+		if err := pxu.Set(name, val); err != nil {
+			log.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return
+	}
+
 	if profF != nil && *profF {
 		for i := uint16(0); i < 16; i++ {
 			profile, err := pxu.ReadProfile(i)
@@ -85,6 +166,32 @@ func main() {
 
 }
 
+func setOutput(pxu *device.Pxu, output string) {
+	if output == "auto" {
+		if err := pxu.SetControlMode(device.ModeAuto); err != nil {
+			log.Fatalf("Failed to switch to auto mode: %v", err)
+		}
+		return
+	}
+
+	percent, err := strconv.ParseFloat(output, 64)
+	if err != nil {
+		log.Fatalf("Invalid output %q, expected a percentage or auto", output)
+	}
+	if err := pxu.SetControlMode(device.ModeManual); err != nil {
+		log.Fatalf("Failed to switch to manual mode: %v", err)
+	}
+	if err := pxu.SetManualOutput(percent); err != nil {
+		log.Fatalf("Failed to set output: %v", err)
+	}
+
+	power, err := pxu.ReadOutputPower()
+	if err != nil {
+		log.Fatalf("Failed to read output power: %v", err)
+	}
+	fmt.Println(power)
+}
+
 func showStats(pxu *device.Pxu) {
 	stats, err := pxu.ReadStats()
 	if err != nil {
@@ -1,18 +1,39 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/nguba/RedLionPXU/internal/device"
 	"github.com/nguba/RedLionPXU/public/api"
 	"log"
+	"log/slog"
+	"maps"
 	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
-	unit = flag.Int("unit", 5, "Unit Id configured for the device")
-	mock = flag.Bool("mock", false, "Use a mock modbus implementation when testing without the device")
+	unit  = flag.Int("unit", 5, "Unit Id configured for the device")
+	mock  = flag.Bool("mock", false, "Simulate the device and the plant it heats when testing without the device")
+	url   = flag.String("url", "", "Connection URL overriding COM3, e.g. tcp://gateway:502 or rtuovertcp://gateway:4001")
+	units = flag.String("units", "", "Comma separated unit Ids sharing the bus, each served on port 5000 + id (overrides -unit)")
+	cache = flag.Duration("cache", 0, "How long register reads are shared between clients, e.g. 250ms (0 disables the cache)")
+
+	verify = flag.Bool("verify", false, "Read back every register written and fail writes the device did not take")
+	trace  = flag.Bool("trace", false, "Log every modbus transaction")
+	dryRun = flag.Bool("dry-run", false, "Log the writes instead of sending them, later reads return the values written")
+	speed  = flag.Float64("speed", 1, "Simulated time per real time with -mock, e.g. 60 runs an hour long profile in a minute")
+	record = flag.String("record", "", "Write every modbus transaction to the file, for replaying it in a test")
+	spMin  unitValues
+	spMax  unitValues
+	spStep unitValues
+	spRate unitValues
 )
 
 // DefaultConfiguration returns a default configuration for COM3
@@ -22,50 +43,297 @@ func DefaultConfiguration() *device.Configuration {
 		Speed:    device.DefaultSpeed,
 		DataBits: 8,
 		Parity:   "none",
-		Timeout:  500 * time.Millisecond,
+		Timeout:  device.DefaultRTUTimeout,
 	}
 }
 
+func init() {
+	flag.Var(&spMin, "sp-min", "Lowest setpoint accepted, the safety envelope is off unless -sp-max is above -sp-min; "+
+		"one value for every unit or per unit, e.g. 5=20,6=0")
+	flag.Var(&spMax, "sp-max", "Highest setpoint accepted, e.g. 80 or 5=80,6=30")
+	flag.Var(&spStep, "sp-step", "Largest setpoint change accepted in one write (0 for no limit), e.g. 10 or 5=10,6=5")
+	flag.Var(&spRate, "sp-rate", "Setpoint changes accepted per hour (0 for no limit), e.g. 6 or 5=6,6=12")
+}
+
 func main() {
 
 	flag.Parse()
 
-	unitId := device.UnitId(*unit)
+	unitIds, err := parseUnits(*unit, *units)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	var modbus device.Modbus
-	var err error
+	var supervisor *device.Supervisor
 
 	if *mock {
-		log.Println("using mock modbus implementation to impersonate the device")
-		modbus = device.NewMockModbus()
+		log.Printf("simulating the device at %vx speed", *speed)
+		modbus, err = device.NewSimulator(device.SimulatorOptions{Speed: *speed})
 	} else {
 		cfg := DefaultConfiguration()
-		modbus, err = device.NewModbusDevice(cfg)
+		if *url != "" {
+			cfg.URL = *url
+			cfg.Timeout = 0 // use the default of the transport
+		}
+		// the supervisor reopens the port when the adapter is reset
+		supervisor, err = device.NewSupervisor(device.SupervisorOptions{
+			Dial: func() (device.Modbus, error) {
+				return device.NewModbusDevice(cfg)
+			},
+		})
+		modbus = supervisor
 	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	pxu, err := device.NewPxu(unitId, modbus, device.DefaultTimeout, device.DefaultRetries)
-	defer func(pxu *device.Pxu) {
-		_ = pxu.Close()
-	}(pxu)
+	var middlewares []device.Middleware
+	if *trace {
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		middlewares = append(middlewares, device.Logging(logger))
+	}
+	if *dryRun {
+		middlewares = append(middlewares, device.DryRun(slog.Default()))
+	}
+	if *record != "" {
+		// innermost, so the recording holds what went over the wire
+		file, err := os.Create(*record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func(file *os.File) {
+			_ = file.Close()
+		}(file)
+		middlewares = append(middlewares, device.NewRecorder(file).Middleware())
+	}
+	modbus = device.Chain(modbus, middlewares...)
 
-	port := 5000 + *unit
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	// all units share the serial port through the bus
+	bus, err := device.NewBus(modbus)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		log.Fatal(err)
 	}
-	defer func(lis net.Listener) {
-		_ = lis.Close()
-	}(lis)
+	defer func(bus *device.Bus) {
+		_ = bus.Close()
+	}(bus)
 
-	server, err := api.NewServer(pxu, lis)
+	h := &health{state: device.ConnConnected, ready: make(map[*api.Server]bool)}
+	var wg sync.WaitGroup
+	for _, unitId := range unitIds {
+		server, err := newUnitServer(bus, unitId, h)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Start(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	if supervisor != nil {
+		go reportHealth(supervisor, h)
+	}
+	wg.Wait()
+}
+
+// reportHealth passes the connection state on to the health service of every server.
+func reportHealth(supervisor *device.Supervisor, h *health) {
+	for state := range supervisor.States() {
+		log.Printf("connection %v", state)
+		h.setConnState(state)
+	}
+}
+
+// health reports the state of the connection through the servers of the units which are set up.  A unit which did not
+// answer at startup is reported disconnected until it does.
+type health struct {
+	mu    sync.Mutex
+	state device.ConnState
+	ready map[*api.Server]bool
+}
+
+func (h *health) setConnState(state device.ConnState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.state = state
+	for server, ready := range h.ready {
+		if ready {
+			server.SetConnState(state)
+		}
+	}
+}
+
+// setReady adds the server, reporting the connection state once the unit is ready.
+func (h *health) setReady(server *api.Server, ready bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.ready[server] = ready
+	if ready {
+		server.SetConnState(h.state)
+	} else {
+		server.SetConnState(device.ConnDisconnected)
+	}
+}
+
+// newUnitServer creates the gRPC server for one unit on the bus, listening on port 5000 + unit id.  A unit which
+// does not answer is served with the default scale and no capabilities, and set up once the circuit breaker finds it
+// answering again, so it does not hold up the other units on the bus.
+func newUnitServer(bus *device.Bus, unitId device.UnitId, h *health) (*api.Server, error) {
+	pxu, err := device.NewPxu(unitId, bus.Unit(unitId), device.DefaultTimeout, device.DefaultRetries)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	if err := pxu.EnableCache(*cache); err != nil {
+		return nil, err
 	}
-	err = server.Start()
+
+	pxu.EnableWriteVerify(*verify)
+
+	if spMax.Get(unitId) > spMin.Get(unitId) {
+		envelope := &device.SafetyEnvelope{
+			Min:               spMin.Get(unitId),
+			Max:               spMax.Get(unitId),
+			MaxStep:           spStep.Get(unitId),
+			MaxChangesPerHour: int(spRate.Get(unitId)),
+		}
+		if err := pxu.SetSafetyEnvelope(envelope); err != nil {
+			return nil, err
+		}
+	}
+
+	// an unplugged unit fails fast instead of holding up the bus for the others
+	if err := pxu.EnableCircuitBreaker(device.DefaultBreakerThreshold, device.DefaultProbeInterval); err != nil {
+		return nil, err
+	}
+
+	port := 5000 + int(unitId)
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	server, err := api.NewServer(pxu, lis)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setupUnit(pxu, unitId); err != nil {
+		log.Printf("unit %d not set up, serving it once it answers: %v", unitId, err)
+		h.setReady(server, false)
+		go awaitUnit(pxu, unitId, server, h)
+	} else {
+		h.setReady(server, true)
+	}
+	return server, nil
+}
+
+// setupUnit reads the scale and the capabilities of the unit.
+func setupUnit(pxu *device.Pxu, unitId device.UnitId) error {
+	if _, err := pxu.ReadScale(); err != nil {
+		return err
+	}
+
+	// an unknown model is served without capabilities, every operation is allowed
+	caps, err := pxu.DetectCapabilities()
+	switch {
+	case errors.Is(err, device.ErrUnknownModel):
+		log.Printf("unit %d: %v, not checking operations against its features", unitId, err)
+	case err != nil:
+		return err
+	default:
+		log.Printf("unit %d: %v", unitId, caps)
+	}
+	return nil
+}
+
+// awaitUnit sets the unit up once it answers.  While the circuit breaker is open the attempts fail without a request
+// on the bus, its probe finds out when the unit is back.
+func awaitUnit(pxu *device.Pxu, unitId device.UnitId, server *api.Server, h *health) {
+	for {
+		time.Sleep(device.DefaultProbeInterval)
+		if err := setupUnit(pxu, unitId); err != nil {
+			continue
+		}
+		log.Printf("unit %d answering, serving it", unitId)
+		h.setReady(server, true)
+		return
+	}
+}
+
+func parseUnits(unit int, units string) ([]device.UnitId, error) {
+	if units == "" {
+		return []device.UnitId{device.UnitId(unit)}, nil
+	}
+
+	var ids []device.UnitId
+	for _, s := range strings.Split(units, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 8)
+		if err != nil || id == 0 || id > 247 {
+			return nil, fmt.Errorf("invalid unit id %q", s)
+		}
+		ids = append(ids, device.UnitId(id))
+	}
+	return ids, nil
+}
+
+// unitValues is a flag holding either one value for every unit, e.g. 80, or a value per unit, e.g. 5=80,6=30.
+// Units without a value of their own get the one for every unit, 0 unless given.
+type unitValues struct {
+	all   float64
+	units map[device.UnitId]float64
+}
+
+func (v *unitValues) String() string {
+	if len(v.units) == 0 {
+		return strconv.FormatFloat(v.all, 'g', -1, 64)
+	}
+
+	ids := slices.Sorted(maps.Keys(v.units))
+	pairs := make([]string, len(ids))
+	for i, id := range ids {
+		pairs[i] = fmt.Sprintf("%d=%s", id, strconv.FormatFloat(v.units[id], 'g', -1, 64))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v *unitValues) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		val, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q", s)
+		}
+		v.all = val
+		return nil
+	}
+
+	units := make(map[device.UnitId]float64)
+	for _, pair := range strings.Split(s, ",") {
+		idStr, valStr, _ := strings.Cut(pair, "=")
+		id, err := strconv.ParseUint(strings.TrimSpace(idStr), 10, 8)
+		if err != nil || id == 0 || id > 247 {
+			return fmt.Errorf("invalid unit id %q", idStr)
+		}
+		val, err := strconv.ParseFloat(strings.TrimSpace(valStr), 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for unit %d", valStr, id)
+		}
+		units[device.UnitId(id)] = val
+	}
+	v.units = units
+	return nil
+}
+
+// Get returns the value for the unit.
+func (v *unitValues) Get(id device.UnitId) float64 {
+	if val, ok := v.units[id]; ok {
+		return val
 	}
+	return v.all
 }
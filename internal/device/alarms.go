@@ -0,0 +1,248 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// AlarmMode selects when an alarm output trips.
+type AlarmMode uint16
+
+const (
+	AlarmOff           AlarmMode = iota
+	AlarmAbsoluteHigh            // PV above Value
+	AlarmAbsoluteLow             // PV below Value
+	AlarmDeviationHigh           // PV more than Value above SP
+	AlarmDeviationLow            // PV more than Value below SP
+	AlarmBandInside              // PV within Value of SP
+	AlarmBandOutside             // PV further than Value from SP
+)
+
+func (m AlarmMode) String() string {
+	switch m {
+	case AlarmOff:
+		return "OFF"
+	case AlarmAbsoluteHigh:
+		return "ABSOLUTE HIGH"
+	case AlarmAbsoluteLow:
+		return "ABSOLUTE LOW"
+	case AlarmDeviationHigh:
+		return "DEVIATION HIGH"
+	case AlarmDeviationLow:
+		return "DEVIATION LOW"
+	case AlarmBandInside:
+		return "BAND INSIDE"
+	case AlarmBandOutside:
+		return "BAND OUTSIDE"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", m)
+	}
+}
+
+// AlarmConfig holds the configuration of one alarm output.
+type AlarmConfig struct {
+	Id         uint16    `json:"id"`         // 0 for AL1, 1 for AL2
+	Mode       AlarmMode `json:"mode"`       // when the alarm trips
+	Latch      bool      `json:"latch"`      // stays on until reset, instead of clearing with the condition
+	Value      float64   `json:"value"`      // alarm setpoint, or the deviation from SP for the relative modes
+	Hysteresis float64   `json:"hysteresis"` // distance PV has to move back before the alarm clears
+}
+
+func (c AlarmConfig) String() string {
+	return fmt.Sprintf("AL%d: Mode: %s, Latch: %t, Value: %.1f, Hysteresis: %.1f", c.Id+1, c.Mode, c.Latch, c.Value, c.Hysteresis)
+}
+
+func (c AlarmConfig) validate() error {
+	if c.Id >= AlarmCount {
+		return fmt.Errorf("alarm %d out of range [0, %d]", c.Id, AlarmCount-1)
+	}
+
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"almode", float64(c.Mode)},
+		{"alval", c.Value},
+		{"alhys", c.Hysteresis},
+	}
+	for _, v := range values {
+		if err := mustLookupRegister(fmt.Sprintf("%s[%d]", v.name, c.Id)).Validate(v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AlarmStatus is the state of the alarm outputs.  An alarm is latched when its condition cleared but it is configured
+// to stay on until reset.
+type AlarmStatus struct {
+	Active  [AlarmCount]bool `json:"active"`
+	Latched [AlarmCount]bool `json:"latched"`
+}
+
+// NewAlarmStatus decodes the alarm status register.
+func NewAlarmStatus(reg uint16) AlarmStatus {
+	var status AlarmStatus
+	for i := range AlarmCount {
+		status.Active[i] = reg&AlarmActiveMask&(1<<i) != 0
+		status.Latched[i] = reg>>AlarmLatchedShift&(1<<i) != 0
+	}
+	return status
+}
+
+// Any tells whether any alarm is active or latched.
+func (s AlarmStatus) Any() bool {
+	return s.Active != [AlarmCount]bool{} || s.Latched != [AlarmCount]bool{}
+}
+
+func (s AlarmStatus) String() string {
+	states := make([]string, AlarmCount)
+	for i := range AlarmCount {
+		state := "off"
+		switch {
+		case s.Active[i]:
+			state = "on"
+		case s.Latched[i]:
+			state = "latched"
+		}
+		states[i] = fmt.Sprintf("AL%d:%s", i+1, state)
+	}
+	return strings.Join(states, " ")
+}
+
+// ReadAlarmContext reads the configuration of an alarm output.
+func (p *Pxu) ReadAlarmContext(ctx context.Context, id uint16) (*AlarmConfig, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureAlarms); err != nil {
+		return nil, err
+	}
+	if id >= AlarmCount {
+		return nil, fmt.Errorf("alarm %d out of range [0, %d]", id, AlarmCount-1)
+	}
+
+	start := RegAlarmStart + id*AlarmRegStride
+	regs, err := p.readRegistersWithRetry(ctx, start, AlarmRegCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading alarm %d from unit %d: %w", id, p.id, err)
+	}
+
+	scale := p.Scale()
+	return &AlarmConfig{
+		Id:         id,
+		Mode:       AlarmMode(regs[0]),
+		Latch:      regs[1] != 0,
+		Value:      decodeRegister(regs, start, fmt.Sprintf("alval[%d]", id), scale),
+		Hysteresis: decodeRegister(regs, start, fmt.Sprintf("alhys[%d]", id), scale),
+	}, nil
+}
+
+// ReadAlarm calls ReadAlarmContext with a background context.
+func (p *Pxu) ReadAlarm(id uint16) (*AlarmConfig, error) {
+	return p.ReadAlarmContext(context.Background(), id)
+}
+
+// WriteAlarmContext writes the configuration of the alarm output cfg.Id.
+func (p *Pxu) WriteAlarmContext(ctx context.Context, cfg *AlarmConfig) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureAlarms); err != nil {
+		return err
+	}
+	if cfg == nil {
+		return fmt.Errorf("alarm configuration is nil")
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("invalid alarm configuration: %w", err)
+	}
+
+	scale := p.Scale()
+	value, err := mustLookupRegister(fmt.Sprintf("alval[%d]", cfg.Id)).Encode(cfg.Value, scale)
+	if err != nil {
+		return fmt.Errorf("invalid alarm value: %w", err)
+	}
+	hysteresis, err := mustLookupRegister(fmt.Sprintf("alhys[%d]", cfg.Id)).Encode(cfg.Hysteresis, scale)
+	if err != nil {
+		return fmt.Errorf("invalid alarm hysteresis: %w", err)
+	}
+
+	var latch uint16
+	if cfg.Latch {
+		latch = 1
+	}
+
+	start := RegAlarmStart + cfg.Id*AlarmRegStride
+	if err := p.writeRegisters(ctx, start, []uint16{uint16(cfg.Mode), latch, value, hysteresis}); err != nil {
+		return fmt.Errorf("failed writing alarm %d to unit %d: %w", cfg.Id, p.id, err)
+	}
+	return nil
+}
+
+// WriteAlarm calls WriteAlarmContext with a background context.
+func (p *Pxu) WriteAlarm(cfg *AlarmConfig) error {
+	return p.WriteAlarmContext(context.Background(), cfg)
+}
+
+// ReadAlarmStatusContext reads which alarms are active or latched.
+func (p *Pxu) ReadAlarmStatusContext(ctx context.Context) (AlarmStatus, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureAlarms); err != nil {
+		return AlarmStatus{}, err
+	}
+
+	regs, err := p.readRegistersWithRetry(ctx, RegAlarmStatus, 1)
+	if err != nil {
+		return AlarmStatus{}, fmt.Errorf("failed reading alarm status from unit %d: %w", p.id, err)
+	}
+	return NewAlarmStatus(regs[0]), nil
+}
+
+// ReadAlarmStatus calls ReadAlarmStatusContext with a background context.
+func (p *Pxu) ReadAlarmStatus() (AlarmStatus, error) {
+	return p.ReadAlarmStatusContext(context.Background())
+}
+
+// ResetAlarmContext acknowledges a latched alarm, turning it off unless its condition is still present.
+func (p *Pxu) ResetAlarmContext(ctx context.Context, id uint16) error {
+	if id >= AlarmCount {
+		return fmt.Errorf("alarm %d out of range [0, %d]", id, AlarmCount-1)
+	}
+	return p.resetAlarms(ctx, 1<<id)
+}
+
+// ResetAlarm calls ResetAlarmContext with a background context.
+func (p *Pxu) ResetAlarm(id uint16) error {
+	return p.ResetAlarmContext(context.Background(), id)
+}
+
+// ResetAlarmsContext acknowledges every latched alarm.
+func (p *Pxu) ResetAlarmsContext(ctx context.Context) error {
+	return p.resetAlarms(ctx, 1<<AlarmCount-1)
+}
+
+// ResetAlarms calls ResetAlarmsContext with a background context.
+func (p *Pxu) ResetAlarms() error {
+	return p.ResetAlarmsContext(context.Background())
+}
+
+func (p *Pxu) resetAlarms(ctx context.Context, mask uint16) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureAlarms); err != nil {
+		return err
+	}
+
+	// the reset changes the status register next to it, which must not be served from the cache
+	defer p.invalidate(RegAlarmStatus, 1)
+
+	if err := p.writeRegister(ctx, RegAlarmReset, mask); err != nil {
+		return fmt.Errorf("failed resetting alarms 0x%02X on unit %d: %w", mask, p.id, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewAlarmStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		reg      uint16
+		expected AlarmStatus
+		any      bool
+		str      string
+	}{
+		{"none", 0x0000, AlarmStatus{}, false, "AL1:off AL2:off"},
+		{"AL1 active", 0x0001, AlarmStatus{Active: [AlarmCount]bool{true, false}}, true, "AL1:on AL2:off"},
+		{"AL2 latched", 0x0200, AlarmStatus{Latched: [AlarmCount]bool{false, true}}, true, "AL1:off AL2:latched"},
+		{"both", 0x0103, AlarmStatus{Active: [AlarmCount]bool{true, true}, Latched: [AlarmCount]bool{true, false}}, true, "AL1:on AL2:on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := NewAlarmStatus(tt.reg)
+			if status != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, status)
+			}
+			if status.Any() != tt.any {
+				t.Errorf("expected Any() %t, got %t", tt.any, status.Any())
+			}
+			if status.String() != tt.str {
+				t.Errorf("expected %q, got %q", tt.str, status.String())
+			}
+		})
+	}
+}
+
+func TestPxu_Alarm(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *AlarmConfig
+		regs []uint16
+		err  bool
+	}{
+		{"absolute high", &AlarmConfig{Id: 0, Mode: AlarmAbsoluteHigh, Value: 25.5, Hysteresis: 0.5}, []uint16{1, 0, 255, 5}, false},
+		{"latched band", &AlarmConfig{Id: 1, Mode: AlarmBandOutside, Latch: true, Value: 2, Hysteresis: 0.2}, []uint16{6, 1, 20, 2}, false},
+		{"cold crash", &AlarmConfig{Id: 0, Mode: AlarmAbsoluteLow, Value: -1, Hysteresis: 0}, []uint16{2, 0, 0xFFF6, 0}, false},
+		{"invalid alarm", &AlarmConfig{Id: AlarmCount, Mode: AlarmAbsoluteHigh}, nil, true},
+		{"invalid mode", &AlarmConfig{Id: 0, Mode: AlarmBandOutside + 1}, nil, true},
+		{"negative hysteresis", &AlarmConfig{Id: 0, Mode: AlarmAbsoluteHigh, Hysteresis: -1}, nil, true},
+		{"nil", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			pxu, err := NewPxu(1, mock, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			err = pxu.WriteAlarm(tt.cfg)
+			if tt.err {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			start := RegAlarmStart + tt.cfg.Id*AlarmRegStride
+			regs, _ := mock.ReadRegisters(start, AlarmRegCount)
+			for i, reg := range tt.regs {
+				if regs[i] != reg {
+					t.Errorf("expected register %d to be 0x%04X, got 0x%04X", start+uint16(i), reg, regs[i])
+				}
+			}
+
+			got, err := pxu.ReadAlarm(tt.cfg.Id)
+			if err != nil {
+				t.Fatalf("unexpected error reading back: %v", err)
+			}
+			if *got != *tt.cfg {
+				t.Errorf("expected %v, got %v", tt.cfg, got)
+			}
+		})
+	}
+}
+
+func TestPxu_AlarmStatus(t *testing.T) {
+	mock := NewMockModbus()
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	if err := pxu.EnableCache(time.Minute); err != nil {
+		t.Fatalf("failed to enable cache: %v", err)
+	}
+
+	_ = mock.SetRegister(RegAlarmStatus, 0x0100)
+	status, err := pxu.ReadAlarmStatus()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !status.Latched[0] || status.Active[0] {
+		t.Errorf("expected AL1 latched, got %v", status)
+	}
+
+	if err := pxu.ResetAlarm(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg, _ := mock.ReadRegister(RegAlarmReset); reg != 0x02 {
+		t.Errorf("expected reset of AL2 (0x02), got 0x%02X", reg)
+	}
+
+	// the device clears the latch, which must not be hidden by the cache
+	_ = mock.SetRegister(RegAlarmStatus, 0)
+	if err := pxu.ResetAlarms(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg, _ := mock.ReadRegister(RegAlarmReset); reg != 0x03 {
+		t.Errorf("expected reset of all alarms (0x03), got 0x%02X", reg)
+	}
+	if status, _ := pxu.ReadAlarmStatus(); status.Any() {
+		t.Errorf("expected no alarms after reset, got %v", status)
+	}
+
+	if err := pxu.ResetAlarm(AlarmCount); err == nil {
+		t.Error("expected error resetting an unknown alarm")
+	}
+}
+
+func TestPxu_AlarmsUnsupported(t *testing.T) {
+	registry := CapabilityRegistry
+	defer func() { CapabilityRegistry = registry }()
+	CapabilityRegistry = []CapabilityRule{{Model: "PXU*", Features: []Feature{FeatureProfiles}}}
+
+	mock := &writeCountingModbus{MockModbus: NewMockModbus()}
+	_ = mock.MockModbus.SetRegisters(RegInfoStart, infoRegisters("PXU11", 123))
+
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	if _, err := pxu.DetectCapabilities(); err != nil {
+		t.Fatalf("failed to detect capabilities: %v", err)
+	}
+
+	errs := []error{
+		pxu.WriteAlarm(&AlarmConfig{Mode: AlarmAbsoluteHigh, Value: 30}),
+		pxu.ResetAlarms(),
+		pxu.Set("almode[0]", 1),
+	}
+	_, err = pxu.ReadAlarm(0)
+	errs = append(errs, err)
+	_, err = pxu.ReadAlarmStatus()
+	errs = append(errs, err)
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("operation %d: expected ErrUnsupported, got %v", i, err)
+		}
+	}
+	if mock.writes != 0 {
+		t.Errorf("expected no writes, got %d", mock.writes)
+	}
+}
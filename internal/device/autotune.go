@@ -0,0 +1,170 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Auto-Tune commands
+const (
+	AutoTuneOff = 0
+	AutoTuneOn  = 1
+)
+
+var (
+	ErrAutotuneTimeout    = errors.New("autotune timed out")
+	ErrAutotuneNotStarted = errors.New("autotune did not start")
+)
+
+// AutotuneOptions controls how Autotune waits for the controller to finish.
+type AutotuneOptions struct {
+	Timeout      time.Duration // the tune is aborted when exceeded, DefaultAutotuneTimeout when zero
+	PollInterval time.Duration // time between status polls, DefaultAutotunePoll when zero
+	StartPolls   int           // polls the AT indicator has to come on within, DefaultAutotuneStartPolls when zero
+	Progress     func(*Stats)  // called with every status poll, may be nil
+}
+
+// AutotuneResult holds the PID parameters before and after a tune, so a bad tune can be undone.
+type AutotuneResult struct {
+	Before   PidParameters
+	After    PidParameters
+	Duration time.Duration
+}
+
+func (r AutotuneResult) String() string {
+	return fmt.Sprintf("Before: %v, After: %v, Duration: %v", r.Before, r.After, r.Duration)
+}
+
+// StartAutotuneContext tells the controller to start tuning the active PID parameter set.
+func (p *Pxu) StartAutotuneContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.writeRegister(ctx, RegAutoTune, AutoTuneOn); err != nil {
+		return fmt.Errorf("failed to start autotune on unit %d: %w", p.id, err)
+	}
+	log.Printf("started autotune on unit %d", p.id)
+	return nil
+}
+
+// StartAutotune calls StartAutotuneContext with a background context.
+func (p *Pxu) StartAutotune() error {
+	return p.StartAutotuneContext(context.Background())
+}
+
+// AbortAutotuneContext stops a running tune.  The controller keeps the parameters it had before the tune started.
+func (p *Pxu) AbortAutotuneContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.writeRegister(ctx, RegAutoTune, AutoTuneOff); err != nil {
+		return fmt.Errorf("failed to abort autotune on unit %d: %w", p.id, err)
+	}
+	log.Printf("aborted autotune on unit %d", p.id)
+	return nil
+}
+
+// AbortAutotune calls AbortAutotuneContext with a background context.
+func (p *Pxu) AbortAutotune() error {
+	return p.AbortAutotuneContext(context.Background())
+}
+
+// AutotuneContext runs a complete tune: it records the current PID parameters, starts the tune and polls the
+// controller until the AT indicator goes off again.  The tune is aborted if it does not finish within the timeout or
+// the context is cancelled.  The timeout of the Pxu applies to each poll, not to the tune as a whole.
+func (p *Pxu) AutotuneContext(ctx context.Context, opts AutotuneOptions) (*AutotuneResult, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultAutotuneTimeout
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DefaultAutotunePoll
+	}
+	if opts.StartPolls == 0 {
+		opts.StartPolls = DefaultAutotuneStartPolls
+	}
+
+	before, err := p.ReadPidContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading pid parameters before autotune: %w", err)
+	}
+
+	started := time.Now()
+	if err := p.StartAutotuneContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := p.waitAutotune(ctx, started.Add(opts.Timeout), opts); err != nil {
+		// the abort has to reach the controller even when ctx is what ended the wait
+		if abortErr := p.AbortAutotuneContext(context.WithoutCancel(ctx)); abortErr != nil {
+			return nil, errors.Join(err, abortErr)
+		}
+		return nil, err
+	}
+
+	after, err := p.ReadPidContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading pid parameters after autotune: %w", err)
+	}
+
+	result := &AutotuneResult{Before: *before, After: *after, Duration: time.Since(started)}
+	log.Printf("autotune finished on unit %d: %v", p.id, result)
+	return result, nil
+}
+
+// Autotune calls AutotuneContext with a background context.
+func (p *Pxu) Autotune(opts AutotuneOptions) (*AutotuneResult, error) {
+	return p.AutotuneContext(context.Background(), opts)
+}
+
+// waitAutotune polls the stats until the AT indicator has been seen on and then off again.  A controller which does
+// not raise it within the first polls refused the tune, e.g. in manual mode, and will not finish it either.
+func (p *Pxu) waitAutotune(ctx context.Context, deadline time.Time, opts AutotuneOptions) error {
+	tuning := false
+
+	for poll := 1; ; poll++ {
+		stats, err := p.ReadStatsContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed polling autotune status: %w", err)
+		}
+		if opts.Progress != nil {
+			opts.Progress(stats)
+		}
+
+		if stats.At {
+			tuning = true
+		} else if tuning {
+			return nil
+		} else if poll >= opts.StartPolls {
+			return fmt.Errorf("unit %d: AT not seen after %d polls: %w", p.id, poll, ErrAutotuneNotStarted)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("unit %d after %v: %w", p.id, opts.Timeout, ErrAutotuneTimeout)
+		}
+		if err := sleepContext(ctx, opts.PollInterval); err != nil {
+			return fmt.Errorf("autotune on unit %d interrupted: %w", p.id, err)
+		}
+	}
+}
+
+// UndoAutotuneContext restores the PID parameters the controller had before the tune.
+func (p *Pxu) UndoAutotuneContext(ctx context.Context, result *AutotuneResult) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if result == nil {
+		return fmt.Errorf("autotune result is nil")
+	}
+	if err := p.WritePidContext(ctx, &result.Before); err != nil {
+		return fmt.Errorf("failed to undo autotune on unit %d: %w", p.id, err)
+	}
+	return nil
+}
+
+// UndoAutotune calls UndoAutotuneContext with a background context.
+func (p *Pxu) UndoAutotune(result *AutotuneResult) error {
+	return p.UndoAutotuneContext(context.Background(), result)
+}
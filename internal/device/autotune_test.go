@@ -0,0 +1,139 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// tuningModbus pretends to tune: starting autotune lights the AT indicator, which goes off again after a number of
+// stats polls, leaving new PID parameters behind.  A negative poll count never finishes.
+type tuningModbus struct {
+	*MockModbus
+	polls int
+	tuned PidParameters
+}
+
+func (m *tuningModbus) SetRegister(address, value uint16) error {
+	if address == RegAutoTune {
+		led, _ := m.MockModbus.ReadRegister(RegLED)
+		if value == AutoTuneOn {
+			led |= LEDAt
+		} else {
+			led &^= LEDAt
+		}
+		_ = m.MockModbus.SetRegister(RegLED, led)
+	}
+	return m.MockModbus.SetRegister(address, value)
+}
+
+func (m *tuningModbus) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	if address == 0 && quantity == StatsRegCount {
+		led, _ := m.MockModbus.ReadRegister(RegLED)
+		if led&LEDAt != 0 {
+			if m.polls == 0 {
+				_ = m.MockModbus.SetRegister(RegLED, led&^LEDAt)
+				tp, _ := mustLookupRegister("tp").Encode(m.tuned.TP, DefaultScale)
+				_ = m.MockModbus.SetRegisters(RegTP, []uint16{tp, m.tuned.TI, m.tuned.TD})
+			}
+			m.polls--
+		}
+	}
+	return m.MockModbus.ReadRegisters(address, quantity)
+}
+
+func newTuningPxu(t *testing.T, polls int) (*Pxu, *tuningModbus) {
+	t.Helper()
+
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+	_ = mock.SetRegisters(RegTP, []uint16{100, 120, 30})
+
+	client := &tuningModbus{MockModbus: mock, polls: polls, tuned: PidParameters{TP: 4.2, TI: 300, TD: 75}}
+	pxu, err := NewPxu(1, client, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	return pxu, client
+}
+
+func TestPxu_Autotune(t *testing.T) {
+	pxu, client := newTuningPxu(t, 3)
+
+	var progress []bool
+	result, err := pxu.Autotune(AutotuneOptions{
+		Timeout:      time.Second,
+		PollInterval: time.Millisecond,
+		Progress: func(stats *Stats) {
+			progress = append(progress, stats.At)
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(progress) != 4 || progress[len(progress)-1] {
+		t.Errorf("expected 3 polls while tuning and a final one without AT, got %v", progress)
+	}
+
+	before := PidParameters{TP: 10.0, TI: 120, TD: 30}
+	if result.Before != before {
+		t.Errorf("expected parameters before tune %v, got %v", before, result.Before)
+	}
+	if result.After != client.tuned {
+		t.Errorf("expected parameters after tune %v, got %v", client.tuned, result.After)
+	}
+
+	if err := pxu.UndoAutotune(result); err != nil {
+		t.Fatalf("failed to undo autotune: %v", err)
+	}
+	restored, err := pxu.ReadPid()
+	if err != nil {
+		t.Fatalf("failed to read pid parameters: %v", err)
+	}
+	if *restored != before {
+		t.Errorf("expected restored parameters %v, got %v", before, restored)
+	}
+}
+
+func TestPxu_AutotuneTimeout(t *testing.T) {
+	pxu, client := newTuningPxu(t, -1)
+
+	_, err := pxu.Autotune(AutotuneOptions{Timeout: 20 * time.Millisecond, PollInterval: time.Millisecond})
+	if !errors.Is(err, ErrAutotuneTimeout) {
+		t.Fatalf("expected ErrAutotuneTimeout, got %v", err)
+	}
+
+	at, _ := client.ReadRegister(RegAutoTune)
+	if at != AutoTuneOff {
+		t.Errorf("expected autotune to be aborted, got %d", at)
+	}
+}
+
+func TestPxu_AutotuneNotStarted(t *testing.T) {
+	// the plain mock never raises AT
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	polls := 0
+	_, err = pxu.Autotune(AutotuneOptions{
+		Timeout:      time.Hour,
+		PollInterval: time.Millisecond,
+		Progress:     func(*Stats) { polls++ },
+	})
+	if !errors.Is(err, ErrAutotuneNotStarted) || errors.Is(err, ErrAutotuneTimeout) {
+		t.Fatalf("expected ErrAutotuneNotStarted, got %v", err)
+	}
+	if polls != DefaultAutotuneStartPolls {
+		t.Errorf("expected to give up after %d polls, got %d", DefaultAutotuneStartPolls, polls)
+	}
+
+	at, _ := mock.ReadRegister(RegAutoTune)
+	if at != AutoTuneOff {
+		t.Errorf("expected autotune to be aborted, got %d", at)
+	}
+}
@@ -0,0 +1,109 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreaker stops sending requests to a unit which no longer answers.  After threshold consecutive transient
+// failures the circuit opens and every request fails at once with ErrCircuitOpen, so the unit cannot hold up the
+// bus for the others.  While open, the probe is run in the background every interval and the circuit closes again
+// as soon as the unit answers.
+type CircuitBreaker struct {
+	threshold int
+	interval  time.Duration
+	probe     func() error
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	stopped  bool
+	stop     chan struct{}
+}
+
+// NewCircuitBreaker creates a closed circuit breaker.  Stop has to be called to end a running probe.
+func NewCircuitBreaker(threshold int, interval time.Duration, probe func() error) (*CircuitBreaker, error) {
+	if threshold <= 0 {
+		return nil, fmt.Errorf("threshold must be positive, got %d", threshold)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("probe interval must be positive, got %v", interval)
+	}
+	if probe == nil {
+		return nil, fmt.Errorf("probe cannot be nil")
+	}
+	return &CircuitBreaker{threshold: threshold, interval: interval, probe: probe, stop: make(chan struct{})}, nil
+}
+
+// Allow returns ErrCircuitOpen while the circuit is open.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// Record counts the outcome of a request.  Any answer from the unit, even an exception, resets the count.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !IsTransient(err) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold && !b.open && !b.stopped {
+		b.open = true
+		go b.probeLoop()
+	}
+}
+
+// Open tells whether requests are currently refused.
+func (b *CircuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// Stop ends the background probe.  An open circuit stays open.
+func (b *CircuitBreaker) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.stopped {
+		b.stopped = true
+		close(b.stop)
+	}
+}
+
+func (b *CircuitBreaker) probeLoop() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.probe(); IsTransient(err) {
+			continue
+		}
+
+		b.mu.Lock()
+		b.open = false
+		b.failures = 0
+		b.mu.Unlock()
+		return
+	}
+}
@@ -0,0 +1,122 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var reachable atomic.Bool
+	probe := func() error {
+		if reachable.Load() {
+			return nil
+		}
+		return ErrTimeout
+	}
+
+	breaker, err := NewCircuitBreaker(3, 10*time.Millisecond, probe)
+	if err != nil {
+		t.Fatalf("failed to create circuit breaker: %v", err)
+	}
+	defer breaker.Stop()
+
+	breaker.Record(ErrTimeout)
+	breaker.Record(ErrTimeout)
+	breaker.Record(&ExceptionError{Code: ExIllegalDataAddress}) // the unit answered
+	breaker.Record(ErrTimeout)
+	breaker.Record(ErrTimeout)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected closed circuit, got %v", err)
+	}
+
+	breaker.Record(ErrTimeout)
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	// the probe keeps failing
+	time.Sleep(50 * time.Millisecond)
+	if !breaker.Open() {
+		t.Fatal("expected circuit to stay open while the unit is unreachable")
+	}
+
+	reachable.Store(true)
+	deadline := time.Now().Add(time.Second)
+	for breaker.Open() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the probe to close the circuit")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPxu_CircuitBreaker(t *testing.T) {
+	client := &failingModbus{MockModbus: NewMockModbus()}
+	pxu, err := NewPxu(1, client, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	defer pxu.Close()
+
+	if err := pxu.SetRetryPolicy(RetryPolicy{Retries: 1, Base: time.Millisecond, Max: time.Millisecond, Multiplier: 1}); err != nil {
+		t.Fatalf("failed to set retry policy: %v", err)
+	}
+	if err := pxu.EnableCircuitBreaker(4, time.Hour); err != nil {
+		t.Fatalf("failed to enable circuit breaker: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := pxu.ReadStats(); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expected ErrTimeout, got %v", err)
+		}
+	}
+
+	if _, err := pxu.ReadStats(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if client.reads != 4 {
+		t.Errorf("expected the open circuit to stop requests after 4 reads, got %d", client.reads)
+	}
+}
+
+func TestPxu_CircuitBreakerProbeQueued(t *testing.T) {
+	client := &countingModbus{MockModbus: NewMockModbus()}
+	pxu, err := NewPxu(1, client, 50*time.Millisecond, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	defer pxu.Close()
+
+	if err := pxu.EnableCircuitBreaker(1, 5*time.Millisecond); err != nil {
+		t.Fatalf("failed to enable circuit breaker: %v", err)
+	}
+	_, breaker := pxu.settings()
+	breaker.Record(ErrTimeout)
+
+	// while another request holds the bus, the probe waits for its turn
+	if err := pxu.queue.acquire(context.Background(), PriorityHigh); err != nil {
+		t.Fatalf("failed to acquire the queue: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if reads := client.reads.Load(); reads != 0 {
+		t.Errorf("expected the probe to wait for the bus, got %d reads", reads)
+	}
+	if !breaker.Open() {
+		t.Error("expected the circuit to stay open while the probe has no turn")
+	}
+	pxu.queue.release()
+
+	deadline := time.Now().Add(time.Second)
+	for breaker.Open() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the probe to close the circuit")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if client.reads.Load() == 0 {
+		t.Error("expected the probe to read the unit")
+	}
+}
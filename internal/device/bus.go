@@ -0,0 +1,179 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+var ErrBusClosed = errors.New("bus closed")
+
+// Bus shares one Modbus client, and with it the serial port, between the units on an RS-485 line.  Each transaction
+// holds the bus exclusively and sets the unit ID before it is sent, so handles for different units can be used from
+// different goroutines.  When units are waiting, the bus is handed to them round-robin, so a unit polled in a tight
+// loop cannot starve writes to another.
+type Bus struct {
+	client Modbus
+
+	mu      sync.Mutex
+	busy    bool
+	closed  bool
+	units   []UnitId // round-robin order
+	last    int      // index into units of the unit served last
+	waiting map[UnitId][]chan error
+}
+
+// NewBus takes ownership of the client.  Closing the bus closes the client.
+func NewBus(client Modbus) (*Bus, error) {
+	if client == nil {
+		return nil, fmt.Errorf("modbus client cannot be nil")
+	}
+	return &Bus{client: client, waiting: make(map[UnitId][]chan error)}, nil
+}
+
+// Unit returns a handle for one unit on the bus.  The handle implements Modbus and can be passed to NewPxu.
+func (b *Bus) Unit(id UnitId) *BusUnit {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.index(id)
+	return &BusUnit{bus: b, id: id}
+}
+
+// Close fails all waiting transactions and closes the client.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	for id, queue := range b.waiting {
+		for _, ready := range queue {
+			ready <- ErrBusClosed
+		}
+		delete(b.waiting, id)
+	}
+	b.mu.Unlock()
+
+	return b.client.Close()
+}
+
+// index returns the position of the unit in the round-robin order, adding it when it is new.  b.mu must be held.
+func (b *Bus) index(id UnitId) int {
+	if i := slices.Index(b.units, id); i >= 0 {
+		return i
+	}
+	b.units = append(b.units, id)
+	return len(b.units) - 1
+}
+
+func (b *Bus) acquire(id UnitId) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBusClosed
+	}
+
+	i := b.index(id)
+	if !b.busy {
+		b.busy = true
+		b.last = i
+		b.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan error, 1)
+	b.waiting[id] = append(b.waiting[id], ready)
+	b.mu.Unlock()
+
+	return <-ready
+}
+
+// release hands the bus to the next waiting unit after the one served last, or marks it idle.
+func (b *Bus) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for n := 1; n <= len(b.units); n++ {
+		i := (b.last + n) % len(b.units)
+		id := b.units[i]
+
+		queue := b.waiting[id]
+		if len(queue) == 0 {
+			continue
+		}
+
+		b.waiting[id] = queue[1:]
+		b.last = i
+		queue[0] <- nil
+		return
+	}
+
+	b.busy = false
+}
+
+// do runs a transaction for the unit while holding the bus.
+func (b *Bus) do(id UnitId, transaction func(Modbus) error) error {
+	if err := b.acquire(id); err != nil {
+		return err
+	}
+	defer b.release()
+
+	if err := b.client.SetUnitId(id); err != nil {
+		return fmt.Errorf("failed selecting unit %d: %w", id, err)
+	}
+	return transaction(b.client)
+}
+
+// BusUnit is the handle of one unit on a Bus.
+type BusUnit struct {
+	bus *Bus
+	id  UnitId
+}
+
+// SetUnitId only accepts the unit the handle was created for, use Bus.Unit to talk to another one.
+func (u *BusUnit) SetUnitId(id UnitId) error {
+	if id != u.id {
+		return fmt.Errorf("bus handle is bound to unit %d, not %d", u.id, id)
+	}
+	return nil
+}
+
+func (u *BusUnit) ReadRegister(address uint16) (uint16, error) {
+	val := uint16(ErrVal)
+	err := u.bus.do(u.id, func(client Modbus) error {
+		var err error
+		val, err = client.ReadRegister(address)
+		return err
+	})
+	return val, err
+}
+
+func (u *BusUnit) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	var regs []uint16
+	err := u.bus.do(u.id, func(client Modbus) error {
+		var err error
+		regs, err = client.ReadRegisters(address, quantity)
+		return err
+	})
+	return regs, err
+}
+
+func (u *BusUnit) SetRegister(address uint16, value uint16) error {
+	return u.bus.do(u.id, func(client Modbus) error {
+		return client.SetRegister(address, value)
+	})
+}
+
+func (u *BusUnit) SetRegisters(startAddr uint16, values []uint16) error {
+	return u.bus.do(u.id, func(client Modbus) error {
+		return client.SetRegisters(startAddr, values)
+	})
+}
+
+// Close releases the handle.  The bus and its client stay open for the other units.
+func (u *BusUnit) Close() error {
+	return nil
+}
@@ -0,0 +1,207 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// multiDropModbus simulates several units on one line: every request goes to the unit selected last.
+type multiDropModbus struct {
+	mu      sync.Mutex
+	current UnitId
+	units   map[UnitId]*MockModbus
+	served  []UnitId
+	gate    chan struct{} // when set, every read waits for a token
+}
+
+func newMultiDropModbus(ids ...UnitId) *multiDropModbus {
+	m := &multiDropModbus{units: make(map[UnitId]*MockModbus)}
+	for _, id := range ids {
+		m.units[id] = NewMockModbus()
+		_ = m.units[id].SetRegisters(0, m.units[id].GetStatsRegister())
+	}
+	return m
+}
+
+func (m *multiDropModbus) unit() (*MockModbus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.served = append(m.served, m.current)
+	if unit, ok := m.units[m.current]; ok {
+		return unit, nil
+	}
+	return nil, fmt.Errorf("no response from unit %d", m.current)
+}
+
+func (m *multiDropModbus) SetUnitId(id UnitId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = id
+	return nil
+}
+
+func (m *multiDropModbus) ReadRegister(address uint16) (uint16, error) {
+	unit, err := m.unit()
+	if err != nil {
+		return ErrVal, err
+	}
+	return unit.ReadRegister(address)
+}
+
+func (m *multiDropModbus) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	if m.gate != nil {
+		<-m.gate
+	}
+	unit, err := m.unit()
+	if err != nil {
+		return nil, err
+	}
+	return unit.ReadRegisters(address, quantity)
+}
+
+func (m *multiDropModbus) SetRegister(address uint16, value uint16) error {
+	unit, err := m.unit()
+	if err != nil {
+		return err
+	}
+	return unit.SetRegister(address, value)
+}
+
+func (m *multiDropModbus) SetRegisters(startAddr uint16, values []uint16) error {
+	unit, err := m.unit()
+	if err != nil {
+		return err
+	}
+	return unit.SetRegisters(startAddr, values)
+}
+
+func (m *multiDropModbus) Close() error {
+	return nil
+}
+
+func TestBus_UnitsDoNotCrossTalk(t *testing.T) {
+	ids := []UnitId{1, 2, 3, 4}
+	client := newMultiDropModbus(ids...)
+
+	bus, err := NewBus(client)
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer bus.Close()
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		pxu, err := NewPxu(id, bus.Unit(id), time.Second, 1)
+		if err != nil {
+			t.Fatalf("failed to create PXU: %v", err)
+		}
+
+		wg.Add(1)
+		go func(id UnitId) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				sp := float64(id)*10 + float64(i)/10
+				if err := pxu.UpdateSetpoint(sp); err != nil {
+					t.Errorf("unit %d: failed to update sp: %v", id, err)
+					return
+				}
+				stats, err := pxu.ReadStats()
+				if err != nil {
+					t.Errorf("unit %d: failed to read stats: %v", id, err)
+					return
+				}
+				if stats.Sp != sp {
+					t.Errorf("unit %d: expected sp %.1f, got %.1f", id, sp, stats.Sp)
+					return
+				}
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+func TestBus_RoundRobin(t *testing.T) {
+	client := newMultiDropModbus(1, 2)
+	client.gate = make(chan struct{})
+
+	bus, err := NewBus(client)
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	defer bus.Close()
+
+	// waitFor polls the bus state until the condition holds
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			bus.mu.Lock()
+			ok := cond()
+			bus.mu.Unlock()
+			if ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	queued := func(id UnitId, n int) {
+		t.Helper()
+		waitFor(fmt.Sprintf("%d requests of unit %d", n, id), func() bool { return len(bus.waiting[id]) == n })
+	}
+
+	var wg sync.WaitGroup
+	read := func(u *BusUnit) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = u.ReadRegisters(RegPV, 1)
+		}()
+	}
+
+	// unit 1 holds the bus and queues up more polls before unit 2 asks for it
+	poller, writer := bus.Unit(1), bus.Unit(2)
+	read(poller)
+	waitFor("the bus to be taken", func() bool { return bus.busy })
+	for i := 0; i < 5; i++ {
+		read(poller)
+	}
+	queued(1, 5)
+	read(writer)
+	queued(2, 1)
+
+	for i := 0; i < 7; i++ {
+		client.gate <- struct{}{}
+	}
+	wg.Wait()
+
+	expected := []UnitId{1, 2, 1, 1, 1, 1, 1}
+	if fmt.Sprint(client.served) != fmt.Sprint(expected) {
+		t.Errorf("expected units served in order %v, got %v", expected, client.served)
+	}
+}
+
+func TestBus_Close(t *testing.T) {
+	bus, err := NewBus(newMultiDropModbus(1))
+	if err != nil {
+		t.Fatalf("failed to create bus: %v", err)
+	}
+	unit := bus.Unit(1)
+
+	if err := unit.SetUnitId(2); err == nil {
+		t.Error("expected error when rebinding a handle")
+	}
+
+	if err := bus.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := unit.ReadRegisters(RegPV, 1); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("expected ErrBusClosed, got %v", err)
+	}
+}
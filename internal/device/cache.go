@@ -0,0 +1,144 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CacheStats counts how the reads of a Pxu with a cache were served.
+type CacheStats struct {
+	Hits          uint64 // served from a result younger than the TTL
+	Coalesced     uint64 // joined an identical read already in flight
+	Misses        uint64 // sent to the device
+	Invalidations uint64 // writes which dropped cached results
+}
+
+// Saved returns the number of reads which did not need a bus transaction.
+func (s CacheStats) Saved() uint64 {
+	return s.Hits + s.Coalesced
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("Hits: %d, Coalesced: %d, Misses: %d, Invalidations: %d",
+		s.Hits, s.Coalesced, s.Misses, s.Invalidations)
+}
+
+type cacheKey struct {
+	addr  uint16
+	count uint16
+}
+
+type cacheEntry struct {
+	regs    []uint16
+	expires time.Time
+}
+
+// cacheCall is a read in flight, which identical reads wait for instead of sending their own.
+type cacheCall struct {
+	done       chan struct{}
+	generation uint64
+	regs       []uint16
+	err        error
+}
+
+// registerCache keeps the results of register reads for a short time and merges identical reads in flight.  Every
+// write moves it to a new generation: results read before the write are neither served nor stored afterwards.
+type registerCache struct {
+	ttl time.Duration
+
+	mu         sync.Mutex
+	generation uint64
+	entries    map[cacheKey]cacheEntry
+	inflight   map[cacheKey]*cacheCall
+	stats      CacheStats
+}
+
+func newRegisterCache(ttl time.Duration) *registerCache {
+	return &registerCache{
+		ttl:      ttl,
+		entries:  make(map[cacheKey]cacheEntry),
+		inflight: make(map[cacheKey]*cacheCall),
+	}
+}
+
+// read returns the registers from the cache, from a read in flight or, when there is neither, from fetch.  The fetch
+// is shared by every caller merged onto it, so it runs on its own and must not depend on the context of the caller
+// starting it: each caller stops waiting when its ctx is done, without failing the others.
+func (c *registerCache) read(ctx context.Context, addr, count uint16, fetch func() ([]uint16, error)) ([]uint16, error) {
+	key := cacheKey{addr: addr, count: count}
+
+	c.mu.Lock()
+	if entry, ok := c.entries[key]; ok {
+		if time.Now().Before(entry.expires) {
+			c.stats.Hits++
+			c.mu.Unlock()
+			return slices.Clone(entry.regs), nil
+		}
+		delete(c.entries, key)
+	}
+
+	if call, ok := c.inflight[key]; ok && call.generation == c.generation {
+		c.stats.Coalesced++
+		c.mu.Unlock()
+		return call.wait(ctx)
+	}
+
+	call := &cacheCall{done: make(chan struct{}), generation: c.generation}
+	c.inflight[key] = call
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	go func() {
+		call.regs, call.err = fetch()
+
+		c.mu.Lock()
+		if c.inflight[key] == call {
+			delete(c.inflight, key)
+		}
+		if call.err == nil && call.generation == c.generation {
+			c.entries[key] = cacheEntry{regs: call.regs, expires: time.Now().Add(c.ttl)}
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	return call.wait(ctx)
+}
+
+// wait returns the result of the read, or the context error when ctx is done first.
+func (call *cacheCall) wait(ctx context.Context) ([]uint16, error) {
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		return slices.Clone(call.regs), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// invalidate drops every cached result overlapping the count registers written at addr.
+func (c *registerCache) invalidate(addr uint16, count int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations++
+
+	end := int(addr) + count
+	for key := range c.entries {
+		if int(key.addr) < end && int(key.addr)+int(key.count) > int(addr) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *registerCache) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
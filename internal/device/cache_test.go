@@ -0,0 +1,208 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingModbus counts the reads reaching the device.  When gate is set, every read waits for it to be closed.
+type countingModbus struct {
+	*MockModbus
+	reads atomic.Int32
+	gate  chan struct{}
+}
+
+func (m *countingModbus) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	m.reads.Add(1)
+	if m.gate != nil {
+		<-m.gate
+	}
+	return m.MockModbus.ReadRegisters(address, quantity)
+}
+
+func newCachedPxu(t *testing.T, client Modbus, ttl time.Duration) *Pxu {
+	t.Helper()
+
+	pxu, err := NewPxu(1, client, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	if err := pxu.EnableCache(ttl); err != nil {
+		t.Fatalf("failed to enable cache: %v", err)
+	}
+	return pxu
+}
+
+func TestPxu_CacheTTL(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+	client := &countingModbus{MockModbus: mock}
+	pxu := newCachedPxu(t, client, 50*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if _, err := pxu.ReadStats(); err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+	}
+	if reads := client.reads.Load(); reads != 1 {
+		t.Errorf("expected 1 read within the ttl, got %d", reads)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := pxu.ReadStats(); err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if reads := client.reads.Load(); reads != 2 {
+		t.Errorf("expected a new read after the ttl, got %d reads", reads)
+	}
+
+	expected := CacheStats{Hits: 2, Misses: 2}
+	if stats := pxu.CacheStats(); stats != expected || stats.Saved() != 2 {
+		t.Errorf("expected %v, got %v", expected, stats)
+	}
+}
+
+func TestPxu_CacheCoalesce(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+	client := &countingModbus{MockModbus: mock, gate: make(chan struct{})}
+	pxu := newCachedPxu(t, client, time.Minute)
+
+	const readers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pxu.ReadStats(); err != nil {
+				t.Errorf("failed to read stats: %v", err)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for pxu.CacheStats().Coalesced != readers-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the reads to coalesce: %v", pxu.CacheStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(client.gate)
+	wg.Wait()
+
+	if reads := client.reads.Load(); reads != 1 {
+		t.Errorf("expected a single read for %d callers, got %d", readers, reads)
+	}
+}
+
+func TestPxu_CacheInvalidate(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+	client := &countingModbus{MockModbus: mock}
+	pxu := newCachedPxu(t, client, time.Minute)
+
+	if _, err := pxu.ReadStats(); err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if _, err := pxu.ReadInfo(); err != nil {
+		t.Fatalf("failed to read info: %v", err)
+	}
+
+	if err := pxu.UpdateSetpoint(42); err != nil {
+		t.Fatalf("failed to update sp: %v", err)
+	}
+
+	stats, err := pxu.ReadStats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Sp != 42 {
+		t.Errorf("expected the written sp 42, got %v", stats.Sp)
+	}
+	if _, err := pxu.ReadInfo(); err != nil {
+		t.Fatalf("failed to read info: %v", err)
+	}
+
+	// the info block does not overlap the setpoint and stays cached
+	if reads := client.reads.Load(); reads != 3 {
+		t.Errorf("expected 3 reads, got %d", reads)
+	}
+}
+
+func TestRegisterCache_WriteDuringRead(t *testing.T) {
+	cache := newRegisterCache(time.Minute)
+
+	fetched := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_, _ = cache.read(context.Background(), RegSP, 1, func() ([]uint16, error) {
+			close(fetched)
+			<-release
+			return []uint16{100}, nil
+		})
+	}()
+	<-fetched
+
+	cache.invalidate(RegSP, 1)
+
+	// a read after the write must not join the one which started before it
+	regs, err := cache.read(context.Background(), RegSP, 1, func() ([]uint16, error) {
+		return []uint16{200}, nil
+	})
+	close(release)
+	if err != nil || regs[0] != 200 {
+		t.Fatalf("expected the value read after the write, got %v (%v)", regs, err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	regs, _ = cache.read(context.Background(), RegSP, 1, func() ([]uint16, error) {
+		t.Error("expected a cached result")
+		return nil, nil
+	})
+	if regs[0] != 200 {
+		t.Errorf("expected the stale read not to be stored, got %v", regs)
+	}
+}
+
+func TestPxu_CacheCoalesceLeaderCancelled(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+	client := &countingModbus{MockModbus: mock, gate: make(chan struct{})}
+	pxu := newCachedPxu(t, client, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := pxu.ReadStatsContext(ctx)
+		leader <- err
+	}()
+	for client.reads.Load() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	follower := make(chan error, 1)
+	go func() {
+		_, err := pxu.ReadStats()
+		follower <- err
+	}()
+	for pxu.CacheStats().Coalesced != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-leader; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the leader to be cancelled, got %v", err)
+	}
+
+	close(client.gate)
+	if err := <-follower; err != nil {
+		t.Errorf("expected the follower to get the read, got %v", err)
+	}
+	if reads := client.reads.Load(); reads != 1 {
+		t.Errorf("expected a single read, got %d", reads)
+	}
+}
@@ -0,0 +1,111 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupported  = errors.New("not supported by")
+	ErrUnknownModel = errors.New("unknown model")
+)
+
+// Feature is a part of the controller which not every model or firmware has.
+type Feature uint8
+
+const (
+	FeatureNone     Feature = iota // available on every model
+	FeatureOut2                    // second control output, e.g. for cooling
+	FeatureAlarms                  // alarm outputs
+	FeatureProfiles                // ramp/soak profiles
+)
+
+func (f Feature) String() string {
+	switch f {
+	case FeatureNone:
+		return "none"
+	case FeatureOut2:
+		return "Out2"
+	case FeatureAlarms:
+		return "alarms"
+	case FeatureProfiles:
+		return "profiles"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", f)
+	}
+}
+
+// CapabilityRule assigns features to the models matching Model, a pattern as used by path.Match, e.g. "PXU??2*"
+// for every model with the Out2 option.  MinFirmware restricts the rule to newer firmware.
+type CapabilityRule struct {
+	Model       string
+	MinFirmware float64
+	Features    []Feature
+}
+
+// CapabilityRegistry is searched in order and the first rule matching the model and firmware applies, so the more
+// specific rules go first.  The model code reads PXU<size><main output><options>..., where the options code is 0 for
+// the main output alone, 1 for two alarm outputs and 2 for Out2 and two alarm outputs.  The letter codes A, B and C
+// are the same options with RS485 communications.  Models with another options code are unknown rather than assumed
+// to have everything.
+var CapabilityRegistry = []CapabilityRule{
+	{Model: "PXU??[0A]*", Features: []Feature{FeatureProfiles}},
+	{Model: "PXU??[1B]*", Features: []Feature{FeatureAlarms, FeatureProfiles}},
+	{Model: "PXU??[2C]*", Features: []Feature{FeatureOut2, FeatureAlarms, FeatureProfiles}},
+}
+
+// Capabilities lists the features of a controller.
+type Capabilities struct {
+	Model    string
+	Firmware float64
+	Features []Feature
+}
+
+// NewCapabilities looks the model and firmware of the info block up in the CapabilityRegistry.
+func NewCapabilities(info Info) (*Capabilities, error) {
+	model := strings.ToUpper(strings.TrimSpace(info.Model))
+	firmware, err := strconv.ParseFloat(info.Firmware, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid firmware version %q: %w", info.Firmware, err)
+	}
+
+	for _, rule := range CapabilityRegistry {
+		matched, err := path.Match(rule.Model, model)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capability rule %q: %w", rule.Model, err)
+		}
+		if matched && firmware >= rule.MinFirmware {
+			return &Capabilities{Model: model, Firmware: firmware, Features: slices.Clone(rule.Features)}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q with firmware %v", ErrUnknownModel, info.Model, info.Firmware)
+}
+
+// Has tells whether the controller has the feature.
+func (c *Capabilities) Has(feature Feature) bool {
+	return feature == FeatureNone || slices.Contains(c.Features, feature)
+}
+
+func (c *Capabilities) String() string {
+	return fmt.Sprintf("Model: %s, Firmware: %.2f, Features: %v", c.Model, c.Firmware, c.Features)
+}
+
+// UnsupportedError is returned for operations which need a feature the controller does not have.  It matches
+// ErrUnsupported.
+type UnsupportedError struct {
+	Unit    UnitId
+	Model   string
+	Feature Feature
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("unit %d: %v %s %s", e.Unit, e.Feature, ErrUnsupported, e.Model)
+}
+
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
@@ -0,0 +1,205 @@
+package device
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     Info
+		expected []Feature
+		err      error
+	}{
+		{"main output only", Info{Model: "PXU11000", Firmware: "1.23"}, []Feature{FeatureProfiles}, nil},
+		{"alarms", Info{Model: "PXU42120", Firmware: "1.23"}, []Feature{FeatureAlarms, FeatureProfiles}, nil},
+		{"out2 and alarms", Info{Model: "PXU21220", Firmware: "1.23"}, []Feature{FeatureOut2, FeatureAlarms, FeatureProfiles}, nil},
+		{"letter code main output only", Info{Model: "PXU11A20", Firmware: "1.23"}, []Feature{FeatureProfiles}, nil},
+		{"letter code alarms", Info{Model: "PXU41B20", Firmware: "1.23"}, []Feature{FeatureAlarms, FeatureProfiles}, nil},
+		{"letter code out2 and alarms", Info{Model: "PXU21C20", Firmware: "1.23"}, []Feature{FeatureOut2, FeatureAlarms, FeatureProfiles}, nil},
+		{"unknown letter code", Info{Model: "PXU11Z20", Firmware: "1.23"}, nil, ErrUnknownModel},
+		{"lower case", Info{Model: " pxu31220 ", Firmware: "2.00"}, []Feature{FeatureOut2, FeatureAlarms, FeatureProfiles}, nil},
+		{"unknown option", Info{Model: "PXU11920", Firmware: "1.23"}, nil, ErrUnknownModel},
+		{"no option digit", Info{Model: "PXU41", Firmware: "1.23"}, nil, ErrUnknownModel},
+		{"unknown model", Info{Model: "PM-100", Firmware: "2.00"}, nil, ErrUnknownModel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps, err := NewCapabilities(tt.info)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if !slices.Equal(caps.Features, tt.expected) {
+				t.Errorf("expected features %v, got %v", tt.expected, caps.Features)
+			}
+			if !caps.Has(FeatureNone) {
+				t.Error("expected every model to have FeatureNone")
+			}
+		})
+	}
+}
+
+func TestNewCapabilities_Firmware(t *testing.T) {
+	registry := CapabilityRegistry
+	defer func() { CapabilityRegistry = registry }()
+
+	// profiles only from firmware 2.0 on
+	CapabilityRegistry = []CapabilityRule{
+		{Model: "PXU*", MinFirmware: 2.0, Features: []Feature{FeatureOut2, FeatureProfiles}},
+		{Model: "PXU*", Features: []Feature{FeatureOut2}},
+	}
+
+	tests := []struct {
+		firmware string
+		profiles bool
+	}{
+		{"1.23", false},
+		{"2.00", true},
+		{"2.10", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.firmware, func(t *testing.T) {
+			caps, err := NewCapabilities(Info{Model: "PXU41", Firmware: tt.firmware})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if caps.Has(FeatureProfiles) != tt.profiles {
+				t.Errorf("expected profiles %v, got %v", tt.profiles, caps)
+			}
+			if !caps.Has(FeatureOut2) {
+				t.Errorf("expected Out2, got %v", caps)
+			}
+		})
+	}
+
+	if _, err := NewCapabilities(Info{Model: "PXU41", Firmware: "abc"}); err == nil {
+		t.Error("expected error for invalid firmware")
+	}
+}
+
+// writeCountingModbus counts the writes which reach the device.
+type writeCountingModbus struct {
+	*MockModbus
+	writes int
+}
+
+func (m *writeCountingModbus) SetRegister(address, value uint16) error {
+	m.writes++
+	return m.MockModbus.SetRegister(address, value)
+}
+
+func (m *writeCountingModbus) SetRegisters(startAddr uint16, values []uint16) error {
+	m.writes++
+	return m.MockModbus.SetRegisters(startAddr, values)
+}
+
+func TestPxu_Unsupported(t *testing.T) {
+	registry := CapabilityRegistry
+	defer func() { CapabilityRegistry = registry }()
+	CapabilityRegistry = []CapabilityRule{{Model: "PXU*", Features: []Feature{FeatureOut2}}}
+
+	mock := &writeCountingModbus{MockModbus: NewMockModbus()}
+	_ = mock.MockModbus.SetRegisters(RegInfoStart, infoRegisters("PXU41", 123))
+
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	// everything is allowed until the capabilities are known
+	if err := pxu.SelectProfile(1); err != nil {
+		t.Fatalf("unexpected error before detection: %v", err)
+	}
+
+	caps, err := pxu.DetectCapabilities()
+	if err != nil {
+		t.Fatalf("failed to detect capabilities: %v", err)
+	}
+	if caps.Model != "PXU41" || caps.Has(FeatureProfiles) || pxu.Capabilities() != caps {
+		t.Fatalf("unexpected capabilities %v", caps)
+	}
+	mock.writes = 0
+
+	ops := map[string]func() error{
+		"ReadProfile":    func() error { _, err := pxu.ReadProfile(0); return err },
+		"WriteProfile":   func() error { return pxu.WriteProfile(&Profile{}) },
+		"SelectProfile":  func() error { return pxu.SelectProfile(2) },
+		"StartProfile":   func() error { return pxu.StartProfile(2, 0) },
+		"PauseProfile":   pxu.PauseProfile,
+		"ResumeProfile":  pxu.ResumeProfile,
+		"AdvanceSegment": pxu.AdvanceSegment,
+		"EndProfile":     pxu.EndProfile,
+		"Get":            func() error { _, err := pxu.Get("segsp[0]"); return err },
+		"Set":            func() error { return pxu.Set("link[0]", 3) },
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			err := op()
+			if !errors.Is(err, ErrUnsupported) {
+				t.Errorf("expected ErrUnsupported, got %v", err)
+			}
+			var unsupported *UnsupportedError
+			if !errors.As(err, &unsupported) || unsupported.Feature != FeatureProfiles || unsupported.Model != "PXU41" {
+				t.Errorf("expected an UnsupportedError for profiles on the PXU41, got %v", err)
+			}
+		})
+	}
+	if mock.writes != 0 {
+		t.Errorf("expected no writes to unsupported registers, got %d", mock.writes)
+	}
+
+	// registers every model has are unaffected
+	if err := pxu.Set("sp", 100); err != nil {
+		t.Errorf("unexpected error setting the setpoint: %v", err)
+	}
+}
+
+func TestPxu_UnsupportedByModel(t *testing.T) {
+	// a relay main output without Out2 or alarms
+	mock := &writeCountingModbus{MockModbus: NewMockModbus()}
+	_ = mock.MockModbus.SetRegisters(RegInfoStart, infoRegisters("PXU11000", 123))
+	_ = mock.MockModbus.SetRegister(RegControlMode, uint16(ModeManual))
+
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	if _, err := pxu.DetectCapabilities(); err != nil {
+		t.Fatalf("failed to detect capabilities: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		op      func() error
+		feature Feature
+	}{
+		{"SetManualOutput on Out2", func() error { return pxu.SetManualOutput(-50) }, FeatureOut2},
+		{"WriteAlarm", func() error { return pxu.WriteAlarm(&AlarmConfig{Mode: AlarmAbsoluteHigh, Value: 80}) }, FeatureAlarms},
+		{"Set alval", func() error { return pxu.Set("alval[0]", 80) }, FeatureAlarms},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unsupported *UnsupportedError
+			if err := tt.op(); !errors.As(err, &unsupported) || unsupported.Feature != tt.feature {
+				t.Errorf("expected %v to be unsupported, got %v", tt.feature, err)
+			}
+		})
+	}
+	if mock.writes != 0 {
+		t.Errorf("expected no writes, got %d", mock.writes)
+	}
+
+	// Out1 is on every model
+	if err := pxu.SetManualOutput(50); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
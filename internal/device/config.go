@@ -0,0 +1,121 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+var ErrInvalidConfiguration = errors.New("invalid configuration")
+
+// Transport is the scheme of the configuration URL.
+type Transport string
+
+const (
+	TransportRTU        Transport = "rtu"        // serial line, e.g. rtu:///dev/ttyUSB0
+	TransportTCP        Transport = "tcp"        // Modbus TCP gateway, e.g. tcp://10.0.0.20:502
+	TransportRTUOverTCP Transport = "rtuovertcp" // transparent Ethernet-to-RS485 gateway, e.g. rtuovertcp://10.0.0.20:4001
+)
+
+// Configuration stores the settings for communication with the device.
+// Example URL:  rtu://COM3 (windows), rtu:///dev/ttyUSB0 (Linux), tcp://gateway:502, rtuovertcp://gateway:4001.
+// Zero values fall back to the defaults of the transport.
+type Configuration struct {
+	URL      string
+	Speed    uint
+	DataBits uint
+	Parity   string // none, even or odd
+	StopBits uint   // 2 without parity, 1 otherwise when zero
+	Timeout  time.Duration
+}
+
+// Transport returns the transport selected by the URL scheme.
+func (c *Configuration) Transport() (Transport, error) {
+	scheme, address, ok := strings.Cut(c.URL, "://")
+	if !ok || address == "" {
+		return "", fmt.Errorf("%w: url %q must look like <transport>://<address>", ErrInvalidConfiguration, c.URL)
+	}
+
+	switch t := Transport(strings.ToLower(scheme)); t {
+	case TransportRTU:
+		return t, nil
+	case TransportTCP, TransportRTUOverTCP:
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", fmt.Errorf("%w: url %q needs host:port: %v", ErrInvalidConfiguration, c.URL, err)
+		}
+		return t, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported transport %q, expected rtu, tcp or rtuovertcp", ErrInvalidConfiguration, scheme)
+	}
+}
+
+// Validate checks the configuration without opening the connection.
+func (c *Configuration) Validate() error {
+	_, err := c.clientConfiguration()
+	return err
+}
+
+func (c *Configuration) clientConfiguration() (*modbus.ClientConfiguration, error) {
+	transport, err := c.Transport()
+	if err != nil {
+		return nil, err
+	}
+
+	parity, err := parseParity(c.Parity)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.DataBits != 0 && c.DataBits != 7 && c.DataBits != 8 {
+		return nil, fmt.Errorf("%w: data bits must be 7 or 8, got %d", ErrInvalidConfiguration, c.DataBits)
+	}
+	if c.StopBits > 2 {
+		return nil, fmt.Errorf("%w: stop bits must be 1 or 2, got %d", ErrInvalidConfiguration, c.StopBits)
+	}
+	if c.Timeout < 0 {
+		return nil, fmt.Errorf("%w: negative timeout %v", ErrInvalidConfiguration, c.Timeout)
+	}
+
+	cfg := &modbus.ClientConfiguration{
+		URL:      string(transport) + "://" + strings.SplitN(c.URL, "://", 2)[1],
+		Speed:    c.Speed,
+		DataBits: c.DataBits,
+		Parity:   parity,
+		StopBits: c.StopBits,
+		Timeout:  c.Timeout,
+		Logger:   log.Default(),
+	}
+
+	if cfg.Speed == 0 {
+		cfg.Speed = DefaultSpeed
+	}
+	if cfg.DataBits == 0 {
+		cfg.DataBits = 8
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultTCPTimeout
+		if transport == TransportRTU {
+			cfg.Timeout = DefaultRTUTimeout
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseParity(parity string) (uint, error) {
+	switch strings.ToLower(parity) {
+	case "", "none", "n":
+		return modbus.PARITY_NONE, nil
+	case "even", "e":
+		return modbus.PARITY_EVEN, nil
+	case "odd", "o":
+		return modbus.PARITY_ODD, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown parity %q, expected none, even or odd", ErrInvalidConfiguration, parity)
+	}
+}
@@ -0,0 +1,89 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+func TestConfiguration_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Configuration
+		transport   Transport
+		expectError bool
+	}{
+		{name: "serial windows", cfg: Configuration{URL: "rtu://COM3"}, transport: TransportRTU},
+		{name: "serial linux", cfg: Configuration{URL: "rtu:///dev/ttyUSB0", Parity: "even", StopBits: 1}, transport: TransportRTU},
+		{name: "modbus tcp", cfg: Configuration{URL: "tcp://10.0.0.20:502"}, transport: TransportTCP},
+		{name: "rtu over tcp", cfg: Configuration{URL: "RTUoverTCP://gateway:4001"}, transport: TransportRTUOverTCP},
+		{name: "missing scheme", cfg: Configuration{URL: "COM3"}, expectError: true},
+		{name: "missing address", cfg: Configuration{URL: "rtu://"}, expectError: true},
+		{name: "unsupported scheme", cfg: Configuration{URL: "udp://10.0.0.20:502"}, expectError: true},
+		{name: "tcp without port", cfg: Configuration{URL: "tcp://10.0.0.20"}, expectError: true},
+		{name: "unknown parity", cfg: Configuration{URL: "rtu://COM3", Parity: "mark"}, expectError: true},
+		{name: "invalid data bits", cfg: Configuration{URL: "rtu://COM3", DataBits: 9}, expectError: true},
+		{name: "invalid stop bits", cfg: Configuration{URL: "rtu://COM3", StopBits: 3}, expectError: true},
+		{name: "negative timeout", cfg: Configuration{URL: "rtu://COM3", Timeout: -time.Second}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+
+			if tt.expectError {
+				if !errors.Is(err, ErrInvalidConfiguration) {
+					t.Errorf("expected ErrInvalidConfiguration, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if transport, _ := tt.cfg.Transport(); transport != tt.transport {
+				t.Errorf("expected transport %s, got %s", tt.transport, transport)
+			}
+		})
+	}
+}
+
+func TestConfiguration_Defaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Configuration
+		expected modbus.ClientConfiguration
+	}{
+		{
+			name:     "serial",
+			cfg:      Configuration{URL: "rtu://COM3"},
+			expected: modbus.ClientConfiguration{URL: "rtu://COM3", Speed: DefaultSpeed, DataBits: 8, Parity: modbus.PARITY_NONE, Timeout: DefaultRTUTimeout},
+		},
+		{
+			name:     "serial with parity",
+			cfg:      Configuration{URL: "rtu://COM3", Speed: 9600, Parity: "Odd", StopBits: 1, Timeout: time.Second},
+			expected: modbus.ClientConfiguration{URL: "rtu://COM3", Speed: 9600, DataBits: 8, Parity: modbus.PARITY_ODD, StopBits: 1, Timeout: time.Second},
+		},
+		{
+			name:     "gateway",
+			cfg:      Configuration{URL: "rtuovertcp://gateway:4001", Parity: "even"},
+			expected: modbus.ClientConfiguration{URL: "rtuovertcp://gateway:4001", Speed: DefaultSpeed, DataBits: 8, Parity: modbus.PARITY_EVEN, Timeout: DefaultTCPTimeout},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.cfg.clientConfiguration()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			cfg.Logger = nil
+			if *cfg != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *cfg)
+			}
+		})
+	}
+}
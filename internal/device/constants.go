@@ -6,10 +6,14 @@ import "time"
 const (
 	RegPV               = 0  // Process Value
 	RegSP               = 1  // Active Setpoint
+	RegOut1Power        = 2  // Output Power 1, written in manual mode; negative values drive Out2
+	RegOut2Power        = 3  // Output Power 2
 	RegTP               = 10 // Proportional Band
 	RegTI               = 11 // Integral Time
 	RegTD               = 12 // Derivative Time
 	RegTGroup           = 14 // Parameter Set Selection
+	RegAutoTune         = 15 // Auto-Tune Start/Abort
+	RegControlMode      = 16 // Auto/Manual Mode
 	RegControllerStatus = 17 // Controller Status
 	RegLED              = 20 // LED Status
 	RegPC               = 25 // Current Profile
@@ -19,6 +23,29 @@ const (
 	StatsRegCount = 30
 )
 
+// Alarm registers
+const (
+	RegAlarmStatus = 21 // Alarm State, see the alarm status bit masks
+	RegAlarmReset  = 22 // Alarm Reset, write a bit per latched alarm to reset
+	RegAlarmStart  = 1020
+
+	AlarmCount     = 2 // alarm outputs AL1 and AL2
+	AlarmRegStride = 8 // registers reserved per alarm
+	AlarmRegCount  = 4 // mode, latch, value, hysteresis
+)
+
+// Alarm status bit masks: bit n is set while alarm n is active, bit n+8 while it is latched
+const (
+	AlarmActiveMask   uint16 = 0x00FF
+	AlarmLatchedShift        = 8
+)
+
+// Modbus protocol limits for a single request
+const (
+	MaxReadRegisters  = 125 // function code 3
+	MaxWriteRegisters = 123 // function code 16
+)
+
 // Device info registers
 const (
 	RegInfoStart = 1000
@@ -26,6 +53,22 @@ const (
 	InfoRegCount = 7
 )
 
+// Input configuration registers
+const (
+	RegInputType    = 1010 // Input Type
+	RegDecimalPoint = 1011 // Decimal Point Position
+
+	InputRegCount = 2
+)
+
+// Input types below InputProcess are temperature sensors (thermocouples and RTDs), the others process signals (mA/V)
+const (
+	InputProcess = 12
+
+	MaxTemperatureDecimals = 1
+	MaxProcessDecimals     = 3
+)
+
 // Profile registers
 const (
 	RegProfDEV          = 1090
@@ -35,6 +78,34 @@ const (
 	RegNumSegments      = 1630
 	RegProfCycleRepeat  = 1650
 	RegProfLink         = 1670
+
+	ProfileSettingsRegCount = 3 // DEV, EBT and IRR
+)
+
+// Profile limits
+const (
+	MaxProfiles      = 16
+	MaxSegments      = 16
+	ProfileRegStride = 32 // registers reserved per profile, a setpoint/time pair per segment
+
+	MinSegmentSp   = -999.9
+	MaxSegmentSp   = 999.9
+	MaxSegmentTime = 999.9 // minutes
+	MaxCycleRepeat = 9999
+)
+
+// Output power limits in percent
+const (
+	MinOutputPower = -100 // full Out2, e.g. cooling
+	MaxOutputPower = 100
+)
+
+// PID tuning limits
+const (
+	PidGroupCount       = 8
+	MaxProportionalBand = 999.9
+	MaxIntegralTime     = 9999 // seconds
+	MaxDerivativeTime   = 9999 // seconds
 )
 
 // LED status bit masks
@@ -67,4 +138,40 @@ const (
 	DefaultRetries = 3
 	DefaultSpeed   = 38400
 	ErrVal         = 10000
+
+	DefaultRTUTimeout = 500 * time.Millisecond
+	DefaultTCPTimeout = time.Second
+
+	DefaultAutotuneTimeout    = time.Hour
+	DefaultAutotunePoll       = 2 * time.Second
+	DefaultAutotuneStartPolls = 3
+
+	DefaultRetryBase       = 100 * time.Millisecond
+	DefaultRetryMax        = 2 * time.Second
+	DefaultRetryMultiplier = 2
+	DefaultRetryJitter     = 0.2
+
+	DefaultBreakerThreshold = 5
+	DefaultProbeInterval    = 5 * time.Second
+
+	DefaultProbeTimeout = 100 * time.Millisecond // time a unit gets to answer a discovery probe, on top of the time on the wire
+
+	DefaultReconnectTimeouts = 10 // consecutive timeouts after which a Supervisor reopens the transport
+)
+
+// Simulator defaults
+const (
+	DefaultSimulatorModel      = "PXU11220" // SSR main output, Out2 and alarms
+	DefaultSimulatorFirmware   = 1.10
+	DefaultSimulatorSpan       = 1000 // process units the proportional band is a percentage of
+	DefaultSimulatorHysteresis = 1.0  // process units around SP for on/off control
+	DefaultSimulatorAutotune   = 10 * time.Minute
+
+	SimulatorStep = time.Second // longest simulated interval computed in one go
+)
+
+// Valid unit IDs of a Modbus server on a serial line
+const (
+	MinUnitId = 1
+	MaxUnitId = 247
 )
@@ -0,0 +1,185 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Defaults of a discovery sweep
+var (
+	DefaultBaudRates = []uint{38400, 19200, 9600, 4800, 2400, 1200}
+	DefaultParities  = []string{"none", "even", "odd"}
+)
+
+// DiscoveryOptions describes the settings a discovery sweeps.  Zero values fall back to the defaults.
+type DiscoveryOptions struct {
+	URL          string        // the port, e.g. rtu://COM3; TCP gateways are only swept for unit IDs
+	BaudRates    []uint        // DefaultBaudRates when empty
+	Parities     []string      // DefaultParities when empty
+	UnitIds      []UnitId      // MinUnitId to MaxUnitId when empty
+	ProbeTimeout time.Duration // how long each unit gets to answer on top of the time on the wire, DefaultProbeTimeout when zero
+
+	// Dial opens the port with the settings to probe, NewModbusDevice when nil
+	Dial func(*Configuration) (Modbus, error)
+
+	// Found is called for every controller as soon as it answers, may be nil
+	Found func(Discovered)
+}
+
+// Discovered is a controller which answered during a discovery.
+type Discovered struct {
+	Unit          UnitId
+	Configuration Configuration
+	Info          Info
+}
+
+func (d Discovered) String() string {
+	c := d.Configuration
+	return fmt.Sprintf("Unit: %d, %v, URL: %s, Speed: %d, Parity: %s", d.Unit, d.Info, c.URL, c.Speed, c.Parity)
+}
+
+// Discover sweeps the baud rates, parities and unit IDs on the port and returns every PXU which answered.  A unit is
+// identified by reading the info block at RegInfoStart and checking the model.  A sweep of all settings takes long
+// on a serial line, the context can end it early; the controllers found until then are returned with the error.
+func Discover(ctx context.Context, opts DiscoveryOptions) ([]Discovered, error) {
+	opts, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []Discovered
+	for _, cfg := range opts.configurations() {
+		units, err := probeLine(ctx, cfg, opts)
+		found = append(found, units...)
+		if err != nil {
+			return found, err
+		}
+	}
+	return found, nil
+}
+
+func (o DiscoveryOptions) withDefaults() (DiscoveryOptions, error) {
+	if len(o.BaudRates) == 0 {
+		o.BaudRates = DefaultBaudRates
+	}
+	if len(o.Parities) == 0 {
+		o.Parities = DefaultParities
+	}
+	if len(o.UnitIds) == 0 {
+		for id := MinUnitId; id <= MaxUnitId; id++ {
+			o.UnitIds = append(o.UnitIds, UnitId(id))
+		}
+	}
+	if o.ProbeTimeout == 0 {
+		o.ProbeTimeout = DefaultProbeTimeout
+	}
+	if o.Dial == nil {
+		o.Dial = func(cfg *Configuration) (Modbus, error) {
+			return NewModbusDevice(cfg)
+		}
+	}
+
+	for _, id := range o.UnitIds {
+		if id < MinUnitId || id > MaxUnitId {
+			return o, fmt.Errorf("%w: unit id %d out of range [%d, %d]", ErrInvalidConfiguration, id, MinUnitId, MaxUnitId)
+		}
+	}
+	for _, cfg := range o.configurations() {
+		if err := cfg.Validate(); err != nil {
+			return o, err
+		}
+	}
+	return o, nil
+}
+
+// configurations lists the line settings to sweep.  Over TCP the serial settings are those of the gateway, so the
+// URL is only probed once.
+func (o DiscoveryOptions) configurations() []*Configuration {
+	base := Configuration{URL: o.URL, DataBits: 8, Timeout: o.ProbeTimeout}
+	if transport, err := base.Transport(); err != nil || transport != TransportRTU {
+		return []*Configuration{&base}
+	}
+
+	var cfgs []*Configuration
+	for _, speed := range o.BaudRates {
+		for _, parity := range o.Parities {
+			cfg := base
+			cfg.Speed, cfg.Parity = speed, parity
+			cfg.Timeout = probeTimeout(speed, o.ProbeTimeout)
+			cfgs = append(cfgs, &cfg)
+		}
+	}
+	return cfgs
+}
+
+// probeTimeout is the deadline of a probe at the speed: the time the request and the response take on the wire plus
+// the time the unit gets to answer.  The transport sets one deadline over both frames, which at 2400 baud and below
+// take longer than a unit needs to answer.
+func probeTimeout(speed uint, answer time.Duration) time.Duration {
+	const (
+		bitsPerChar = 11                 // start, 8 data, parity or a second stop bit, stop
+		request     = 8                  // unit, function, address, quantity, crc
+		response    = 5 + 2*InfoRegCount // unit, function, byte count, registers, crc
+		silence     = 2 * 4              // 3.5 character times before each frame, rounded up
+		chars       = request + response + silence
+	)
+	return answer + time.Duration(chars*bitsPerChar)*time.Second/time.Duration(speed)
+}
+
+// probeLine opens the port with the settings and asks every unit ID for its info block.
+func probeLine(ctx context.Context, cfg *Configuration, opts DiscoveryOptions) ([]Discovered, error) {
+	client, err := opts.Dial(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening %s at %d baud, parity %s: %w", cfg.URL, cfg.Speed, cfg.Parity, err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	var found []Discovered
+	for _, id := range opts.UnitIds {
+		if err := ctx.Err(); err != nil {
+			return found, err
+		}
+
+		info, err := probeUnit(client, id)
+		if err != nil {
+			continue // nobody there, or a device which is not a PXU
+		}
+
+		unit := Discovered{Unit: id, Configuration: *cfg, Info: *info}
+		log.Printf("found %v", unit)
+		if opts.Found != nil {
+			opts.Found(unit)
+		}
+		found = append(found, unit)
+	}
+	return found, nil
+}
+
+// probeUnit reads the info block of the unit and checks it is a PXU.
+func probeUnit(client Modbus, id UnitId) (*Info, error) {
+	if err := client.SetUnitId(id); err != nil {
+		return nil, err
+	}
+
+	regs, err := client.ReadRegisters(RegInfoStart, InfoRegCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(regs) != InfoRegCount {
+		return nil, fmt.Errorf("%w: expected %d registers, got %d", ErrInvalidResponseLength, InfoRegCount, len(regs))
+	}
+
+	info, err := NewInfo(regs)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(strings.ToUpper(info.Model), "PXU") {
+		return nil, fmt.Errorf("unit %d is a %q, not a PXU", id, info.Model)
+	}
+	return info, nil
+}
@@ -0,0 +1,136 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// infoRegisters encodes the model and firmware like the info block of the device.
+func infoRegisters(model string, firmware uint16) []uint16 {
+	regs := make([]uint16, InfoRegCount)
+	for i := 0; i < len(model) && i/2 < InfoRegCount-1; i++ {
+		regs[i/2] |= uint16(model[i]) << (8 * (1 - i%2))
+	}
+	regs[InfoRegCount-1] = firmware
+	return regs
+}
+
+func TestDiscover(t *testing.T) {
+	// two controllers and a power meter at 19200 baud with even parity
+	line := newMultiDropModbus(3, 5, 9)
+	_ = line.units[3].SetRegisters(RegInfoStart, infoRegisters("PXU41", 123))
+	_ = line.units[5].SetRegisters(RegInfoStart, infoRegisters("PM-100", 200))
+	_ = line.units[9].SetRegisters(RegInfoStart, infoRegisters("PXU11", 110))
+
+	var dialed []string
+	dial := func(cfg *Configuration) (Modbus, error) {
+		dialed = append(dialed, fmt.Sprintf("%d/%s", cfg.Speed, cfg.Parity))
+		if cfg.Speed == 19200 && cfg.Parity == "even" {
+			return line, nil
+		}
+		return newMultiDropModbus(), nil // nobody answers
+	}
+
+	var reported []UnitId
+	found, err := Discover(context.Background(), DiscoveryOptions{
+		URL:       "rtu://COM3",
+		BaudRates: []uint{38400, 19200},
+		Parities:  []string{"none", "even"},
+		Dial:      dial,
+		Found:     func(d Discovered) { reported = append(reported, d.Unit) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectedDials := []string{"38400/none", "38400/even", "19200/none", "19200/even"}
+	if fmt.Sprint(dialed) != fmt.Sprint(expectedDials) {
+		t.Errorf("expected settings %v, got %v", expectedDials, dialed)
+	}
+	if len(found) != 2 || fmt.Sprint(reported) != "[3 9]" {
+		t.Fatalf("expected units 3 and 9, got %v", found)
+	}
+	if found[0].Info.Model != "PXU41" || found[0].Info.Firmware != "1.23" {
+		t.Errorf("unexpected info %v", found[0].Info)
+	}
+	if cfg := found[1].Configuration; cfg.Speed != 19200 || cfg.Parity != "even" || cfg.Timeout != probeTimeout(19200, DefaultProbeTimeout) {
+		t.Errorf("unexpected settings %+v", cfg)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	tests := []struct {
+		speed uint
+		wire  time.Duration // request and response of the probe, without the silence between frames
+	}{
+		{38400, 7734 * time.Microsecond},
+		{2400, 123750 * time.Microsecond},
+		{1200, 247500 * time.Microsecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.speed), func(t *testing.T) {
+			timeout := probeTimeout(tt.speed, DefaultProbeTimeout)
+			if timeout < tt.wire+DefaultProbeTimeout || timeout > 2*tt.wire+DefaultProbeTimeout {
+				t.Errorf("expected the answer time on top of %v on the wire, got %v", tt.wire, timeout)
+			}
+		})
+	}
+}
+
+func TestDiscover_Options(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  DiscoveryOptions
+		dials int
+		err   error
+	}{
+		{name: "tcp gateway is probed once", opts: DiscoveryOptions{URL: "tcp://gateway:502"}, dials: 1},
+		{name: "invalid unit", opts: DiscoveryOptions{URL: "rtu://COM3", UnitIds: []UnitId{0}}, err: ErrInvalidConfiguration},
+		{name: "invalid parity", opts: DiscoveryOptions{URL: "rtu://COM3", Parities: []string{"mark"}}, err: ErrInvalidConfiguration},
+		{name: "invalid url", opts: DiscoveryOptions{URL: "COM3"}, err: ErrInvalidConfiguration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dials := 0
+			tt.opts.Dial = func(*Configuration) (Modbus, error) {
+				dials++
+				return newMultiDropModbus(), nil
+			}
+
+			_, err := Discover(context.Background(), tt.opts)
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected %v, got %v", tt.err, err)
+			}
+			if dials != tt.dials {
+				t.Errorf("expected %d dials, got %d", tt.dials, dials)
+			}
+		})
+	}
+}
+
+func TestDiscover_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	line := newMultiDropModbus(1)
+	_ = line.units[1].SetRegisters(RegInfoStart, infoRegisters("PXU41", 123))
+
+	found, err := Discover(ctx, DiscoveryOptions{
+		URL: "rtu://COM3",
+		Dial: func(*Configuration) (Modbus, error) {
+			return line, nil
+		},
+		Found: func(Discovered) { cancel() },
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(found) != 1 {
+		t.Errorf("expected the unit found before the cancellation, got %v", found)
+	}
+}
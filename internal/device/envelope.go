@@ -0,0 +1,229 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+)
+
+var ErrOutsideEnvelope = errors.New("outside the safety envelope")
+
+// SafetyEnvelope limits the setpoints written to a unit, so a typo of 350 instead of 35.0 does not go through.
+type SafetyEnvelope struct {
+	Min               float64 // lowest setpoint
+	Max               float64 // highest setpoint
+	MaxStep           float64 // largest change from the active setpoint in one write, 0 for no limit
+	MaxChangesPerHour int     // setpoint writes allowed within any hour, 0 for no limit
+
+	// OnOverride is called for every write let through the envelope with WithOverride, may be nil.  Overrides are
+	// logged either way.
+	OnOverride func(Override)
+}
+
+// Validate checks the limits are consistent.
+func (e SafetyEnvelope) Validate() error {
+	switch {
+	case math.IsNaN(e.Min) || math.IsNaN(e.Max) || e.Min > e.Max:
+		return fmt.Errorf("%w: setpoint range [%v, %v] is empty", ErrInvalidConfiguration, e.Min, e.Max)
+	case math.IsNaN(e.MaxStep) || e.MaxStep < 0:
+		return fmt.Errorf("%w: max step %v cannot be negative", ErrInvalidConfiguration, e.MaxStep)
+	case e.MaxChangesPerHour < 0:
+		return fmt.Errorf("%w: max changes per hour %d cannot be negative", ErrInvalidConfiguration, e.MaxChangesPerHour)
+	}
+	return nil
+}
+
+func (e SafetyEnvelope) String() string {
+	return fmt.Sprintf("Range: [%.1f, %.1f], MaxStep: %.1f, MaxChangesPerHour: %d", e.Min, e.Max, e.MaxStep, e.MaxChangesPerHour)
+}
+
+// EnvelopeError is returned for a setpoint outside the safety envelope.  It matches ErrOutsideEnvelope.
+type EnvelopeError struct {
+	Unit     UnitId
+	Setpoint float64
+	Reason   string // which limit was exceeded
+}
+
+func (e *EnvelopeError) Error() string {
+	return fmt.Sprintf("unit %d: setpoint %.1f %s: %s", e.Unit, e.Setpoint, ErrOutsideEnvelope, e.Reason)
+}
+
+func (e *EnvelopeError) Is(target error) bool {
+	return target == ErrOutsideEnvelope
+}
+
+// Override records a setpoint written although it was outside the safety envelope.
+type Override struct {
+	Time     time.Time
+	Unit     UnitId
+	Setpoint float64
+	Reason   string // why the operator overrode the envelope
+	Err      error  // the *EnvelopeError which was overridden
+}
+
+func (o Override) String() string {
+	return fmt.Sprintf("unit %d: setpoint %.1f overridden by %q: %v", o.Unit, o.Setpoint, o.Reason, o.Err)
+}
+
+type overrideKey struct{}
+
+// WithOverride returns a context which lets setpoint writes through the safety envelope, e.g. for a deliberate step
+// beyond MaxStep.  The reason must not be empty; every write let through is logged with it.
+func WithOverride(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, overrideKey{}, reason)
+}
+
+// overrideFrom returns the reason stored in ctx, if there is one.
+func overrideFrom(ctx context.Context) (string, bool) {
+	reason, ok := ctx.Value(overrideKey{}).(string)
+	return reason, ok && reason != ""
+}
+
+// setpointGuard enforces a safety envelope and remembers when the setpoint changed.
+type setpointGuard struct {
+	envelope SafetyEnvelope
+	changes  []time.Time // writes within the last hour, oldest first
+}
+
+// check tests the setpoint against the envelope.  current is only used with a MaxStep.  guard must only be used
+// with the sequence lock held.
+func (g *setpointGuard) check(setpoint, current float64, now time.Time) string {
+	e := g.envelope
+	g.expire(now)
+
+	switch {
+	case setpoint < e.Min:
+		return fmt.Sprintf("below the minimum of %.1f", e.Min)
+	case setpoint > e.Max:
+		return fmt.Sprintf("above the maximum of %.1f", e.Max)
+	case e.MaxStep > 0 && math.Abs(setpoint-current) > e.MaxStep:
+		return fmt.Sprintf("a step of %.1f from %.1f exceeds the maximum of %.1f", math.Abs(setpoint-current), current, e.MaxStep)
+	case e.MaxChangesPerHour > 0 && len(g.changes) >= e.MaxChangesPerHour:
+		return fmt.Sprintf("%d changes within the last hour reached the maximum of %d", len(g.changes), e.MaxChangesPerHour)
+	}
+	return ""
+}
+
+func (g *setpointGuard) record(now time.Time) {
+	if g.envelope.MaxChangesPerHour > 0 {
+		g.changes = append(g.changes, now)
+	}
+}
+
+// expire drops the changes older than an hour.
+func (g *setpointGuard) expire(now time.Time) {
+	i := 0
+	for i < len(g.changes) && now.Sub(g.changes[i]) >= time.Hour {
+		i++
+	}
+	g.changes = slices.Delete(g.changes, 0, i)
+}
+
+// SetSafetyEnvelope enforces the envelope on every setpoint written from then on, nil removes it.  Profile segment
+// setpoints are checked against its range.
+func (p *Pxu) SetSafetyEnvelope(envelope *SafetyEnvelope) error {
+	var guard *setpointGuard
+	if envelope != nil {
+		if err := envelope.Validate(); err != nil {
+			return err
+		}
+		guard = &setpointGuard{envelope: *envelope}
+	}
+
+	p.mu.Lock()
+	p.guard = guard
+	p.mu.Unlock()
+	return nil
+}
+
+// Envelope returns the safety envelope in force, nil when there is none.
+func (p *Pxu) Envelope() *SafetyEnvelope {
+	guard := p.setpointGuard()
+	if guard == nil {
+		return nil
+	}
+	envelope := guard.envelope
+	return &envelope
+}
+
+func (p *Pxu) setpointGuard() *setpointGuard {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.guard
+}
+
+// checkSetpoint tests the setpoint against the safety envelope, reading the active setpoint for a MaxStep.  A
+// violation is let through when ctx carries an override, which is audited.  The sequence lock must be held.
+func (p *Pxu) checkSetpoint(ctx context.Context, guard *setpointGuard, setpoint float64) error {
+	var current float64
+	if guard.envelope.MaxStep > 0 {
+		regs, err := p.readRegistersWithRetry(ctx, RegSP, 1)
+		if err != nil {
+			return fmt.Errorf("failed reading sp from unit %d: %w", p.id, err)
+		}
+		current = mustLookupRegister("sp").Decode(regs[0], p.Scale())
+	}
+
+	reason := guard.check(setpoint, current, time.Now())
+	if reason == "" {
+		return nil
+	}
+
+	return p.override(ctx, guard, &EnvelopeError{Unit: p.id, Setpoint: setpoint, Reason: reason})
+}
+
+// checkSegments tests the segment setpoints of a profile against the range of the safety envelope.
+func (p *Pxu) checkSegments(ctx context.Context, profile *Profile) error {
+	guard := p.setpointGuard()
+	if guard == nil {
+		return nil
+	}
+
+	for _, seg := range profile.Segments {
+		if err := p.checkSegment(ctx, guard, profile.Id, uint16(seg.Id), seg.Sp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSegment tests one segment setpoint against the range of the safety envelope.  The rate limits are about the
+// active setpoint, so a profile is only held to the range.
+func (p *Pxu) checkSegment(ctx context.Context, guard *setpointGuard, profile, segment uint16, setpoint float64) error {
+	if setpoint >= guard.envelope.Min && setpoint <= guard.envelope.Max {
+		return nil
+	}
+
+	reason := fmt.Sprintf("in segment %d of profile %d leaves the range [%.1f, %.1f]",
+		segment, profile, guard.envelope.Min, guard.envelope.Max)
+	return p.override(ctx, guard, &EnvelopeError{Unit: p.id, Setpoint: setpoint, Reason: reason})
+}
+
+// segmentSetpoint tells whether the register holds a segment setpoint, and of which profile and segment.
+func segmentSetpoint(addr uint16) (profile, segment uint16, ok bool) {
+	const end = RegProfSegmentStart + MaxProfiles*ProfileRegStride
+	if addr < RegProfSegmentStart || addr >= end || (addr-RegProfSegmentStart)%2 != 0 {
+		return 0, 0, false
+	}
+	offset := addr - RegProfSegmentStart
+	return offset / ProfileRegStride, offset % ProfileRegStride / 2, true
+}
+
+// override lets the violation through when ctx carries an override, and audits it.
+func (p *Pxu) override(ctx context.Context, guard *setpointGuard, violation *EnvelopeError) error {
+	reason, ok := overrideFrom(ctx)
+	if !ok {
+		return violation
+	}
+
+	audit := Override{Time: time.Now(), Unit: p.id, Setpoint: violation.Setpoint, Reason: reason, Err: violation}
+	log.Printf("SAFETY OVERRIDE %v", audit)
+	if guard.envelope.OnOverride != nil {
+		guard.envelope.OnOverride(audit)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSafetyEnvelope_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope SafetyEnvelope
+		err      bool
+	}{
+		{"valid", SafetyEnvelope{Min: 0, Max: 80, MaxStep: 10, MaxChangesPerHour: 6}, false},
+		{"single setpoint", SafetyEnvelope{Min: 20, Max: 20}, false},
+		{"empty range", SafetyEnvelope{Min: 80, Max: 0}, true},
+		{"negative step", SafetyEnvelope{Max: 80, MaxStep: -1}, true},
+		{"negative rate", SafetyEnvelope{Max: 80, MaxChangesPerHour: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.envelope.Validate(); (err != nil) != tt.err {
+				t.Errorf("expected error %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestPxu_SafetyEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope SafetyEnvelope
+		current  float64   // active setpoint on the device
+		writes   []float64 // setpoints written before the one tested
+		setpoint float64
+		err      bool
+	}{
+		{"within", SafetyEnvelope{Min: 0, Max: 80}, 20, nil, 35, false},
+		{"typo", SafetyEnvelope{Min: 0, Max: 80}, 20, nil, 350, true},
+		{"below", SafetyEnvelope{Min: 0, Max: 80}, 20, nil, -1, true},
+		{"small step", SafetyEnvelope{Min: 0, Max: 80, MaxStep: 5}, 20, nil, 24.5, false},
+		{"large step", SafetyEnvelope{Min: 0, Max: 80, MaxStep: 5}, 20, nil, 35, true},
+		{"large step down", SafetyEnvelope{Min: 0, Max: 80, MaxStep: 5}, 20, nil, 10, true},
+		{"within rate", SafetyEnvelope{Min: 0, Max: 80, MaxChangesPerHour: 3}, 20, []float64{21, 22}, 23, false},
+		{"rate exceeded", SafetyEnvelope{Min: 0, Max: 80, MaxChangesPerHour: 3}, 20, []float64{21, 22, 23}, 24, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &writeCountingModbus{MockModbus: NewMockModbus()}
+			_ = mock.MockModbus.SetRegister(RegSP, uint16(tt.current*10))
+
+			pxu, err := NewPxu(1, mock, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+			if err := pxu.SetSafetyEnvelope(&tt.envelope); err != nil {
+				t.Fatalf("failed to set envelope: %v", err)
+			}
+
+			for _, sp := range tt.writes {
+				if err := pxu.UpdateSetpoint(sp); err != nil {
+					t.Fatalf("unexpected error writing %v: %v", sp, err)
+				}
+			}
+			mock.writes = 0
+
+			err = pxu.UpdateSetpoint(tt.setpoint)
+			if !tt.err {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if reg, _ := mock.ReadRegister(RegSP); reg != uint16(tt.setpoint*10) {
+					t.Errorf("expected sp register %d, got %d", uint16(tt.setpoint*10), reg)
+				}
+				return
+			}
+
+			var envelopeErr *EnvelopeError
+			if !errors.Is(err, ErrOutsideEnvelope) || !errors.As(err, &envelopeErr) || envelopeErr.Setpoint != tt.setpoint {
+				t.Errorf("expected an EnvelopeError for %v, got %v", tt.setpoint, err)
+			}
+			if mock.writes != 0 {
+				t.Errorf("expected no writes, got %d", mock.writes)
+			}
+
+			// Set is held to the same envelope
+			if err := pxu.Set("sp", tt.setpoint); !errors.Is(err, ErrOutsideEnvelope) {
+				t.Errorf("expected Set to be refused, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPxu_SafetyEnvelopeOverride(t *testing.T) {
+	mock := NewMockModbus()
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	var audited []Override
+	envelope := &SafetyEnvelope{Min: 0, Max: 80, MaxStep: 10, OnOverride: func(o Override) { audited = append(audited, o) }}
+	if err := pxu.SetSafetyEnvelope(envelope); err != nil {
+		t.Fatalf("failed to set envelope: %v", err)
+	}
+
+	// an empty reason is no override
+	if err := pxu.UpdateSetpointContext(WithOverride(context.Background(), ""), 90); !errors.Is(err, ErrOutsideEnvelope) {
+		t.Errorf("expected an empty reason to be refused, got %v", err)
+	}
+
+	ctx := WithOverride(context.Background(), "strike water for the mash tun")
+	if err := pxu.UpdateSetpointContext(ctx, 90); err != nil {
+		t.Fatalf("unexpected error with override: %v", err)
+	}
+	if reg, _ := mock.ReadRegister(RegSP); reg != 900 {
+		t.Errorf("expected sp register 900, got %d", reg)
+	}
+
+	// a write within the envelope is not audited
+	if err := pxu.UpdateSetpointContext(ctx, 80); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(audited) != 1 {
+		t.Fatalf("expected 1 audited override, got %d", len(audited))
+	}
+	if o := audited[0]; o.Setpoint != 90 || o.Reason != "strike water for the mash tun" || !errors.Is(o.Err, ErrOutsideEnvelope) {
+		t.Errorf("unexpected audit %v", o)
+	}
+
+	// profiles are held to the range
+	profile := NewProfile(0, 1, LinkEnd, 0)
+	profile.Segments = []Segment{{Id: 0, Sp: 350, T: 10}}
+	if err := pxu.WriteProfile(profile); !errors.Is(err, ErrOutsideEnvelope) {
+		t.Errorf("expected the profile to be refused, got %v", err)
+	}
+	if err := pxu.WriteProfileContext(ctx, profile); err != nil {
+		t.Errorf("unexpected error writing the profile with override: %v", err)
+	}
+	if len(audited) != 2 {
+		t.Errorf("expected 2 audited overrides, got %d", len(audited))
+	}
+
+	// so are segment setpoints written one by one
+	if err := pxu.Set("segsp[17]", 350); !errors.Is(err, ErrOutsideEnvelope) {
+		t.Errorf("expected the segment setpoint to be refused, got %v", err)
+	}
+	if err := pxu.Set("segsp[17]", 75); err != nil {
+		t.Errorf("unexpected error within the envelope: %v", err)
+	}
+	if err := pxu.SetContext(ctx, "segsp[17]", 350); err != nil {
+		t.Errorf("unexpected error writing the segment setpoint with override: %v", err)
+	}
+	if reg, _ := mock.ReadRegister(RegProfSegmentStart + 34); reg != 3500 {
+		t.Errorf("expected segsp register 3500, got %d", reg)
+	}
+	if len(audited) != 3 || audited[2].Reason != "strike water for the mash tun" {
+		t.Errorf("expected 3 audited overrides, got %v", audited)
+	}
+
+	if err := pxu.SetSafetyEnvelope(nil); err != nil || pxu.Envelope() != nil {
+		t.Fatalf("failed to remove envelope: %v", err)
+	}
+	if err := pxu.UpdateSetpoint(350); err != nil {
+		t.Errorf("unexpected error without envelope: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/simonvetter/modbus"
+)
+
+// Failure classes of a Modbus transaction.  The errors returned by ModbusDevice wrap one of them, so callers can tell
+// them apart with errors.Is.
+var (
+	ErrTimeout               = errors.New("timeout")
+	ErrFraming               = errors.New("framing error")
+	ErrDeviceBusy            = errors.New("device busy")
+	ErrInvalidResponseLength = errors.New("invalid response length")
+	ErrException             = errors.New("modbus exception")
+)
+
+// ExceptionCode is the code of an exception response sent by the device.
+type ExceptionCode uint8
+
+const (
+	ExIllegalFunction              ExceptionCode = 0x01
+	ExIllegalDataAddress           ExceptionCode = 0x02
+	ExIllegalDataValue             ExceptionCode = 0x03
+	ExServerDeviceFailure          ExceptionCode = 0x04
+	ExAcknowledge                  ExceptionCode = 0x05
+	ExServerDeviceBusy             ExceptionCode = 0x06
+	ExMemoryParityError            ExceptionCode = 0x08
+	ExGatewayPathUnavailable       ExceptionCode = 0x0A
+	ExGatewayTargetFailedToRespond ExceptionCode = 0x0B
+)
+
+func (c ExceptionCode) String() string {
+	switch c {
+	case ExIllegalFunction:
+		return "illegal function"
+	case ExIllegalDataAddress:
+		return "illegal data address"
+	case ExIllegalDataValue:
+		return "illegal data value"
+	case ExServerDeviceFailure:
+		return "server device failure"
+	case ExAcknowledge:
+		return "acknowledge"
+	case ExServerDeviceBusy:
+		return "server device busy"
+	case ExMemoryParityError:
+		return "memory parity error"
+	case ExGatewayPathUnavailable:
+		return "gateway path unavailable"
+	case ExGatewayTargetFailedToRespond:
+		return "gateway target failed to respond"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", uint8(c))
+	}
+}
+
+// ExceptionError is returned when the device answers with an exception response.  It matches ErrException, and also
+// ErrDeviceBusy or ErrTimeout for the codes which mean the request may succeed when repeated.
+type ExceptionError struct {
+	Code ExceptionCode
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus exception 0x%02X: %v", uint8(e.Code), e.Code)
+}
+
+func (e *ExceptionError) Is(target error) bool {
+	switch target {
+	case ErrException:
+		return true
+	case ErrDeviceBusy:
+		return e.Code == ExServerDeviceBusy
+	case ErrTimeout:
+		// the gateway is fine, the device behind it did not answer
+		return e.Code == ExGatewayTargetFailedToRespond
+	default:
+		return false
+	}
+}
+
+// exceptionCodes maps the exception errors of the modbus library back to their codes.
+var exceptionCodes = map[error]ExceptionCode{
+	modbus.ErrIllegalFunction:         ExIllegalFunction,
+	modbus.ErrIllegalDataAddress:      ExIllegalDataAddress,
+	modbus.ErrIllegalDataValue:        ExIllegalDataValue,
+	modbus.ErrServerDeviceFailure:     ExServerDeviceFailure,
+	modbus.ErrAcknowledge:             ExAcknowledge,
+	modbus.ErrServerDeviceBusy:        ExServerDeviceBusy,
+	modbus.ErrMemoryParityError:       ExMemoryParityError,
+	modbus.ErrGWPathUnavailable:       ExGatewayPathUnavailable,
+	modbus.ErrGWTargetFailedToRespond: ExGatewayTargetFailedToRespond,
+}
+
+// classifyError wraps an error of the modbus library into the matching failure class.  The original error stays in
+// the chain.  Errors which do not belong to a class are returned unchanged.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	for libErr, code := range exceptionCodes {
+		if errors.Is(err, libErr) {
+			return &ExceptionError{Code: code}
+		}
+	}
+
+	switch {
+	case errors.Is(err, modbus.ErrRequestTimedOut):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.Is(err, modbus.ErrBadCRC),
+		errors.Is(err, modbus.ErrShortFrame),
+		errors.Is(err, modbus.ErrProtocolError),
+		errors.Is(err, modbus.ErrBadUnitId),
+		errors.Is(err, modbus.ErrBadTransactionId),
+		errors.Is(err, modbus.ErrUnknownProtocolId):
+		return fmt.Errorf("%w: %w", ErrFraming, err)
+	default:
+		return err
+	}
+}
+
+// IsTransient tells whether the request may succeed when it is repeated: timeouts, garbled frames, truncated
+// responses and a busy device.  Exceptions like an illegal data address will fail again, as will a cancelled context.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrTimeout) ||
+		errors.Is(err, ErrFraming) ||
+		errors.Is(err, ErrDeviceBusy) ||
+		errors.Is(err, ErrInvalidResponseLength)
+}
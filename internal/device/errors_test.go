@@ -0,0 +1,60 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/simonvetter/modbus"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		expected  error
+		transient bool
+	}{
+		{name: "nil", err: nil, expected: nil},
+		{name: "timeout", err: modbus.ErrRequestTimedOut, expected: ErrTimeout, transient: true},
+		{name: "bad crc", err: modbus.ErrBadCRC, expected: ErrFraming, transient: true},
+		{name: "short frame", err: modbus.ErrShortFrame, expected: ErrFraming, transient: true},
+		{name: "protocol error", err: modbus.ErrProtocolError, expected: ErrFraming, transient: true},
+		{name: "illegal data address", err: modbus.ErrIllegalDataAddress, expected: ErrException},
+		{name: "illegal data value", err: modbus.ErrIllegalDataValue, expected: ErrException},
+		{name: "device busy", err: modbus.ErrServerDeviceBusy, expected: ErrDeviceBusy, transient: true},
+		{name: "gateway target", err: modbus.ErrGWTargetFailedToRespond, expected: ErrTimeout, transient: true},
+		{name: "wrapped", err: fmt.Errorf("reading: %w", modbus.ErrBadCRC), expected: ErrFraming, transient: true},
+		{name: "unknown", err: ErrBusClosed, expected: ErrBusClosed},
+		{name: "cancelled", err: context.Canceled, expected: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.err)
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if IsTransient(err) != tt.transient {
+				t.Errorf("expected transient %v for %v", tt.transient, err)
+			}
+		})
+	}
+}
+
+func TestExceptionError(t *testing.T) {
+	err := fmt.Errorf("reading: %w", &ExceptionError{Code: ExIllegalDataAddress})
+
+	var exErr *ExceptionError
+	if !errors.As(err, &exErr) || exErr.Code != ExIllegalDataAddress {
+		t.Fatalf("expected illegal data address exception, got %v", err)
+	}
+	if errors.Is(err, ErrDeviceBusy) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v to match ErrException only", err)
+	}
+	if exErr.Error() != "modbus exception 0x02: illegal data address" {
+		t.Errorf("unexpected message %q", exErr.Error())
+	}
+}
@@ -0,0 +1,385 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a Modbus client to add behaviour to every transaction, e.g. logging or timing.
+type Middleware func(Modbus) Modbus
+
+// Chain wraps the client in the middlewares.  The first one is the outermost: it sees a transaction first and its
+// result last.  For example Chain(client, Logging(logger), DryRun(logger)) logs the writes the dry run swallows.
+func Chain(client Modbus, middlewares ...Middleware) Modbus {
+	for _, middleware := range slices.Backward(middlewares) {
+		client = middleware(client)
+	}
+	return client
+}
+
+// Op is the kind of a Modbus transaction.
+type Op uint8
+
+const (
+	OpSetUnitId Op = iota
+	OpRead
+	OpWrite
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpSetUnitId:
+		return "set unit id"
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", o)
+	}
+}
+
+// Call describes a transaction passing through an Intercept middleware.
+type Call struct {
+	Op       Op
+	Unit     UnitId   // the unit selected, for OpSetUnitId
+	Address  uint16   // first register
+	Quantity uint16   // registers read or written
+	Values   []uint16 // the values to write, or the values read once next returned
+}
+
+func (c *Call) String() string {
+	if c.Op == OpSetUnitId {
+		return fmt.Sprintf("%s %d", c.Op, c.Unit)
+	}
+	return fmt.Sprintf("%s addr=%d qty=%d", c.Op, c.Address, c.Quantity)
+}
+
+// Intercept returns a middleware which calls fn around every transaction except Close.  fn passes the transaction on
+// by calling next, or answers it itself by not doing so.
+func Intercept(fn func(call *Call, next func() error) error) Middleware {
+	return func(client Modbus) Modbus {
+		return &interceptor{client: client, fn: fn}
+	}
+}
+
+type interceptor struct {
+	client Modbus
+	fn     func(call *Call, next func() error) error
+}
+
+func (i *interceptor) SetUnitId(id UnitId) error {
+	call := &Call{Op: OpSetUnitId, Unit: id}
+	return i.fn(call, func() error {
+		return i.client.SetUnitId(id)
+	})
+}
+
+func (i *interceptor) ReadRegister(address uint16) (uint16, error) {
+	call := &Call{Op: OpRead, Address: address, Quantity: 1}
+	err := i.fn(call, func() error {
+		val, err := i.client.ReadRegister(address)
+		if err == nil {
+			call.Values = []uint16{val}
+		}
+		return err
+	})
+	if err != nil {
+		return ErrVal, err
+	}
+	if len(call.Values) != 1 {
+		return ErrVal, fmt.Errorf("%w: expected 1 register, got %d", ErrInvalidResponseLength, len(call.Values))
+	}
+	return call.Values[0], nil
+}
+
+func (i *interceptor) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	call := &Call{Op: OpRead, Address: address, Quantity: quantity}
+	err := i.fn(call, func() error {
+		regs, err := i.client.ReadRegisters(address, quantity)
+		call.Values = regs
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return call.Values, nil
+}
+
+func (i *interceptor) SetRegister(address uint16, value uint16) error {
+	call := &Call{Op: OpWrite, Address: address, Quantity: 1, Values: []uint16{value}}
+	return i.fn(call, func() error {
+		return i.client.SetRegister(address, value)
+	})
+}
+
+func (i *interceptor) SetRegisters(startAddr uint16, values []uint16) error {
+	call := &Call{Op: OpWrite, Address: startAddr, Quantity: uint16(len(values)), Values: values}
+	return i.fn(call, func() error {
+		return i.client.SetRegisters(startAddr, values)
+	})
+}
+
+func (i *interceptor) Close() error {
+	return i.client.Close()
+}
+
+// Logging logs every transaction at debug level, and failed ones at warning level.
+func Logging(logger *slog.Logger) Middleware {
+	return Intercept(func(call *Call, next func() error) error {
+		started := time.Now()
+		err := next()
+
+		attrs := []slog.Attr{
+			slog.String("op", call.Op.String()),
+			slog.Duration("duration", time.Since(started)),
+		}
+		if call.Op == OpSetUnitId {
+			attrs = append(attrs, slog.Int("unit", int(call.Unit)))
+		} else {
+			attrs = append(attrs, slog.Int("addr", int(call.Address)), slog.Int("qty", int(call.Quantity)))
+		}
+
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+			logger.LogAttrs(context.Background(), slog.LevelWarn, "modbus transaction failed", attrs...)
+		} else {
+			logger.LogAttrs(context.Background(), slog.LevelDebug, "modbus transaction", attrs...)
+		}
+		return err
+	})
+}
+
+// DryRun logs the writes instead of sending them, reads and unit selection pass through.  Reads of registers a
+// swallowed write went to return the value written, as the device would, so operations confirming their writes and
+// write-verify mode keep working behind a dry run.  Registers the device changes on its own, like the run status
+// after the profile advance command, keep the value written.
+func DryRun(logger *slog.Logger) Middleware {
+	var (
+		mu      sync.Mutex
+		unit    UnitId
+		written = make(map[dryRunKey]uint16)
+	)
+
+	return Intercept(func(call *Call, next func() error) error {
+		switch call.Op {
+		case OpSetUnitId:
+			err := next()
+			if err == nil {
+				mu.Lock()
+				unit = call.Unit
+				mu.Unlock()
+			}
+			return err
+
+		case OpRead:
+			if err := next(); err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			call.Values = slices.Clone(call.Values)
+			for i := range call.Values {
+				if val, ok := written[dryRunKey{unit: unit, address: call.Address + uint16(i)}]; ok {
+					call.Values[i] = val
+				}
+			}
+			return nil
+		}
+
+		mu.Lock()
+		for i, val := range call.Values {
+			written[dryRunKey{unit: unit, address: call.Address + uint16(i)}] = val
+		}
+		mu.Unlock()
+
+		logger.Info("dry run, write not sent",
+			slog.Int("addr", int(call.Address)), slog.Int("qty", int(call.Quantity)), slog.Any("values", call.Values))
+		return nil
+	})
+}
+
+type dryRunKey struct {
+	unit    UnitId
+	address uint16
+}
+
+// Trace calls start before every transaction except Close, and the function it returns with the outcome, e.g. to
+// open and end a tracing span.  The Modbus interface carries no context, so a span cannot be tied to the request
+// which caused the transaction; it tells where the time on the bus went.
+func Trace(start func(call *Call) (end func(err error))) Middleware {
+	return Intercept(func(call *Call, next func() error) error {
+		end := start(call)
+		err := next()
+		end(err)
+		return err
+	})
+}
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram buckets, sized for serial lines.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// LatencyHistogram counts the transactions of each kind by how long they took.
+type LatencyHistogram struct {
+	buckets []time.Duration
+
+	mu    sync.Mutex
+	stats map[Op]*LatencyStats
+}
+
+// LatencyStats is the histogram of one kind of transaction.  Counts[i] holds the transactions which took at most
+// Buckets[i], the last entry of Counts those which took longer than every bucket.
+type LatencyStats struct {
+	Buckets []time.Duration
+	Counts  []uint64
+	Count   uint64
+	Errors  uint64
+	Sum     time.Duration
+	Max     time.Duration
+}
+
+// Mean returns the average latency.
+func (s LatencyStats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile estimates the latency below which the fraction q of the transactions completed, as the upper bound of its
+// bucket.  Transactions above the last bucket report Max.
+func (s LatencyStats) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	rank := max(1, uint64(q*float64(s.Count)+0.5))
+	var seen uint64
+	for i, count := range s.Counts {
+		seen += count
+		if seen >= rank && i < len(s.Buckets) {
+			return s.Buckets[i]
+		}
+	}
+	return s.Max
+}
+
+func (s LatencyStats) String() string {
+	return fmt.Sprintf("Count: %d, Errors: %d, Mean: %v, P95: %v, Max: %v", s.Count, s.Errors, s.Mean(), s.Quantile(0.95), s.Max)
+}
+
+// NewLatencyHistogram creates a histogram with the bucket upper bounds, DefaultLatencyBuckets when none are given.
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &LatencyHistogram{buckets: buckets, stats: make(map[Op]*LatencyStats)}
+}
+
+// Middleware returns the middleware recording into the histogram.
+func (h *LatencyHistogram) Middleware() Middleware {
+	return Intercept(func(call *Call, next func() error) error {
+		started := time.Now()
+		err := next()
+		h.record(call.Op, time.Since(started), err)
+		return err
+	})
+}
+
+func (h *LatencyHistogram) record(op Op, latency time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.stats[op]
+	if !ok {
+		s = &LatencyStats{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets)+1)}
+		h.stats[op] = s
+	}
+
+	i, _ := slices.BinarySearch(h.buckets, latency)
+	s.Counts[i]++
+	s.Count++
+	s.Sum += latency
+	s.Max = max(s.Max, latency)
+	if err != nil {
+		s.Errors++
+	}
+}
+
+// Snapshot returns the histogram of the transactions of the kind.
+func (h *LatencyHistogram) Snapshot(op Op) LatencyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.stats[op]
+	if !ok {
+		return LatencyStats{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets)+1)}
+	}
+	snapshot := *s
+	snapshot.Counts = slices.Clone(s.Counts)
+	return snapshot
+}
+
+// RegisterCount counts the transactions which touched a register.
+type RegisterCount struct {
+	Reads  uint64
+	Writes uint64
+	Errors uint64
+}
+
+// RegisterCounters counts the reads, writes and failures of every register.
+type RegisterCounters struct {
+	mu     sync.Mutex
+	counts map[uint16]RegisterCount
+}
+
+func NewRegisterCounters() *RegisterCounters {
+	return &RegisterCounters{counts: make(map[uint16]RegisterCount)}
+}
+
+// Middleware returns the middleware counting into the counters.
+func (c *RegisterCounters) Middleware() Middleware {
+	return Intercept(func(call *Call, next func() error) error {
+		err := next()
+		if call.Op != OpSetUnitId {
+			c.record(call, err)
+		}
+		return err
+	})
+}
+
+func (c *RegisterCounters) record(call *Call, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range call.Quantity {
+		addr := call.Address + i
+		count := c.counts[addr]
+		switch {
+		case err != nil:
+			count.Errors++
+		case call.Op == OpRead:
+			count.Reads++
+		default:
+			count.Writes++
+		}
+		c.counts[addr] = count
+	}
+}
+
+// Snapshot returns the counts of every register touched so far, by address.
+func (c *RegisterCounters) Snapshot() map[uint16]RegisterCount {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.counts)
+}
@@ -0,0 +1,225 @@
+package device
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChain(t *testing.T) {
+	var trace []string
+	layer := func(name string) Middleware {
+		return Intercept(func(call *Call, next func() error) error {
+			trace = append(trace, name+" "+call.String())
+			err := next()
+			trace = append(trace, name+" done")
+			return err
+		})
+	}
+
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(10, []uint16{1, 2})
+	client := Chain(mock, layer("outer"), layer("inner"))
+
+	regs, err := client.ReadRegisters(10, 2)
+	if err != nil || !slices.Equal(regs, []uint16{1, 2}) {
+		t.Fatalf("expected [1 2], got %v (%v)", regs, err)
+	}
+
+	expected := []string{"outer read addr=10 qty=2", "inner read addr=10 qty=2", "inner done", "outer done"}
+	if !slices.Equal(trace, expected) {
+		t.Errorf("expected %v, got %v", expected, trace)
+	}
+
+	if Chain(mock) != Modbus(mock) {
+		t.Error("expected an empty chain to return the client")
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	client := Chain(&failingModbus{MockModbus: NewMockModbus()}, Logging(logger))
+	if _, err := client.ReadRegisters(RegPV, 2); err == nil {
+		t.Fatal("expected error but got none")
+	}
+	if err := client.SetRegister(RegSP, 350); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", buf.String())
+	}
+	for _, want := range []string{"level=WARN", "op=read", "addr=0", "qty=2", "error=timeout"} {
+		if !strings.Contains(lines[0], want) {
+			t.Errorf("expected %q to contain %q", lines[0], want)
+		}
+	}
+	for _, want := range []string{"level=DEBUG", "op=write", "addr=1", "qty=1"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("expected %q to contain %q", lines[1], want)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var buf bytes.Buffer
+	mock := NewMockModbus()
+	_ = mock.SetRegister(RegSP, 200)
+
+	client := Chain(mock, DryRun(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err := client.SetRegister(RegSP, 350); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.SetRegisters(RegTP, []uint16{1, 2, 3}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if val, _ := mock.ReadRegister(RegSP); val != 200 {
+		t.Errorf("expected the write not to reach the device, read %d", val)
+	}
+	if regs, _ := mock.ReadRegisters(RegTP, 3); !slices.Equal(regs, []uint16{0, 0, 0}) {
+		t.Errorf("expected the block write not to reach the device, read %v", regs)
+	}
+
+	// reads return what was written, around it they reach the device
+	_ = mock.SetRegister(RegPV, 250)
+	if val, _ := client.ReadRegister(RegSP); val != 350 {
+		t.Errorf("expected the value written, read %d", val)
+	}
+	if regs, _ := client.ReadRegisters(RegPV, 2); !slices.Equal(regs, []uint16{250, 350}) {
+		t.Errorf("expected the device value and the one written, read %v", regs)
+	}
+	if regs, _ := mock.ReadRegisters(RegPV, 2); !slices.Equal(regs, []uint16{250, 200}) {
+		t.Errorf("expected the device untouched, read %v", regs)
+	}
+
+	// per unit
+	_ = client.SetUnitId(6)
+	if val, _ := client.ReadRegister(RegSP); val != 200 {
+		t.Errorf("expected another unit to read the device, read %d", val)
+	}
+	if got := strings.Count(buf.String(), "write not sent"); got != 2 {
+		t.Errorf("expected 2 logged writes, got %d in %q", got, buf.String())
+	}
+}
+
+func TestPxu_DryRunVerify(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegister(RegControllerStatus, uint16(Stop))
+	client := Chain(mock, DryRun(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	pxu, err := NewPxu(1, client, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	pxu.EnableWriteVerify(true)
+
+	if err := pxu.UpdateSetpoint(35); err != nil {
+		t.Errorf("expected the write to be confirmed, got %v", err)
+	}
+	if err := pxu.StartProfile(2, 0); err != nil {
+		t.Errorf("expected the profile start to be confirmed, got %v", err)
+	}
+	if rs, _ := mock.ReadRegister(RegControllerStatus); RunStatus(rs) != Stop {
+		t.Errorf("expected the device untouched, got %v", RunStatus(rs))
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var spans []string
+	client := Chain(&failingModbus{MockModbus: NewMockModbus()}, Trace(func(call *Call) func(error) {
+		return func(err error) {
+			spans = append(spans, fmt.Sprintf("%s: %v", call, err))
+		}
+	}))
+
+	_, _ = client.ReadRegisters(RegPV, 2)
+	_ = client.SetRegister(RegSP, 350)
+
+	expected := []string{"read addr=0 qty=2: timeout", "write addr=1 qty=1: <nil>"}
+	if !slices.Equal(spans, expected) {
+		t.Errorf("expected %v, got %v", expected, spans)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	h := NewLatencyHistogram(10*time.Millisecond, time.Millisecond, 100*time.Millisecond)
+
+	for _, latency := range []time.Duration{500 * time.Microsecond, 2 * time.Millisecond, 5 * time.Millisecond, 50 * time.Millisecond} {
+		h.record(OpRead, latency, nil)
+	}
+	h.record(OpRead, time.Second, ErrTimeout)
+
+	s := h.Snapshot(OpRead)
+	if !slices.Equal(s.Counts, []uint64{1, 2, 1, 1}) {
+		t.Errorf("expected counts [1 2 1 1], got %v", s.Counts)
+	}
+	if s.Count != 5 || s.Errors != 1 || s.Max != time.Second {
+		t.Errorf("unexpected stats %v", s)
+	}
+	if q := s.Quantile(0.5); q != 10*time.Millisecond {
+		t.Errorf("expected median 10ms, got %v", q)
+	}
+	if q := s.Quantile(1); q != time.Second {
+		t.Errorf("expected the slowest transaction to report Max, got %v", q)
+	}
+	if s := h.Snapshot(OpWrite); s.Count != 0 || s.Quantile(0.5) != 0 {
+		t.Errorf("expected no writes, got %v", s)
+	}
+
+	// through a client
+	client := Chain(NewMockModbus(), h.Middleware())
+	_ = client.SetRegister(RegSP, 1)
+	if s := h.Snapshot(OpWrite); s.Count != 1 {
+		t.Errorf("expected 1 write, got %v", s)
+	}
+}
+
+func TestRegisterCounters(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegister(RegLED, LEDCelsius)
+
+	counters := NewRegisterCounters()
+	histogram := NewLatencyHistogram()
+	client := Chain(mock, Logging(slog.New(slog.DiscardHandler)), histogram.Middleware(), counters.Middleware())
+
+	pxu, err := NewPxu(1, client, time.Second, 0)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	if _, err := pxu.ReadStats(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.UpdateSetpoint(35); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	counts := counters.Snapshot()
+	if c := counts[RegSP]; c.Reads != 1 || c.Writes != 1 {
+		t.Errorf("expected sp read and written once, got %+v", c)
+	}
+	if c := counts[StatsRegCount-1]; c.Reads != 1 || c.Writes != 0 {
+		t.Errorf("expected the last stats register read once, got %+v", c)
+	}
+	if _, ok := counts[StatsRegCount]; ok {
+		t.Error("expected registers outside the stats block untouched")
+	}
+	if s := histogram.Snapshot(OpRead); s.Count != 1 {
+		t.Errorf("expected 1 read in the histogram, got %v", s)
+	}
+
+	failing := Chain(&failingModbus{MockModbus: NewMockModbus()}, counters.Middleware())
+	_, _ = failing.ReadRegisters(RegPV, 1)
+	if c := counters.Snapshot()[RegPV]; c.Errors != 1 || c.Reads != 1 {
+		t.Errorf("expected one failed read of pv, got %+v", c)
+	}
+}
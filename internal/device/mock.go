@@ -1,18 +1,16 @@
 package device
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 )
 
 type MockModbus struct {
-	mu            sync.RWMutex
-	unitId        UnitId
-	registers     map[uint16]uint16
-	shouldError   bool
-	errorMessage  string
-	recordingMode bool
-	recordingFile string
+	mu        sync.RWMutex
+	unitId    UnitId
+	registers map[uint16]uint16
+	err       error // returned by the requests while set
 }
 
 // NewMockModbus creates a new mock Modbus client impersonating the RedLion PXU.  A new Pxu can be instantiated
@@ -27,8 +25,8 @@ func (m *MockModbus) SetUnitId(id UnitId) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.shouldError {
-		return fmt.Errorf("SetUnitId: %s", m.errorMessage)
+	if m.err != nil {
+		return fmt.Errorf("SetUnitId: %w", m.err)
 	}
 
 	m.unitId = id
@@ -39,8 +37,8 @@ func (m *MockModbus) ReadRegister(address uint16) (uint16, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.shouldError {
-		return ErrVal, fmt.Errorf("ReadRegister: %s", m.errorMessage)
+	if m.err != nil {
+		return ErrVal, fmt.Errorf("ReadRegister: %w", m.err)
 	}
 	if val, exists := m.registers[address]; exists {
 		return val, nil
@@ -52,8 +50,8 @@ func (m *MockModbus) ReadRegisters(address, quantity uint16) ([]uint16, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.shouldError {
-		return nil, fmt.Errorf("ReadRegisters: %s", m.errorMessage)
+	if m.err != nil {
+		return nil, fmt.Errorf("ReadRegisters: %w", m.err)
 	}
 
 	// Build response from stored registers
@@ -104,10 +102,19 @@ func (m *MockModbus) SetRegisters(startAddr uint16, values []uint16) error {
 
 // SimulateError configures the mock to return errors
 func (m *MockModbus) SimulateError(shouldError bool, message string) {
+	var err error
+	if shouldError {
+		err = errors.New(message)
+	}
+	m.SimulateFailure(err)
+}
+
+// SimulateFailure configures the mock to fail the requests with err, wrapped like the transport does.  A nil err
+// ends the failure.
+func (m *MockModbus) SimulateFailure(err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.shouldError = shouldError
-	m.errorMessage = message
+	m.err = err
 }
 
 func (m *MockModbus) GetStatsRegister() []uint16 {
@@ -1,10 +1,8 @@
 package device
 
 import (
-	"errors"
 	"fmt"
 	"github.com/simonvetter/modbus"
-	"log"
 )
 
 // ModbusDevice implements the communication with the real hardware device.
@@ -13,17 +11,18 @@ type ModbusDevice struct {
 	modbus *modbus.ModbusClient
 }
 
-// NewModbusDevice creates the device from the parameters in the configuration
+// NewModbusDevice creates the device from the parameters in the configuration.  The configuration is validated
+// before the connection is opened.
 func NewModbusDevice(cfg *Configuration) (*ModbusDevice, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("%w: configuration is nil", ErrInvalidConfiguration)
+	}
 
-	modbusConfig := &modbus.ClientConfiguration{
-		URL:      cfg.URL,
-		Speed:    cfg.Speed,    // 38400
-		DataBits: cfg.DataBits, // 8
-		Parity:   modbus.PARITY_NONE,
-		Timeout:  cfg.Timeout, //  500 * time.Millisecond
-		Logger:   log.Default(),
+	modbusConfig, err := cfg.clientConfiguration()
+	if err != nil {
+		return nil, err
 	}
+
 	client, err := modbus.NewClient(modbusConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error creating modbus client: %w", err)
@@ -31,7 +30,7 @@ func NewModbusDevice(cfg *Configuration) (*ModbusDevice, error) {
 
 	err = client.Open() // needed for communicating with this device
 	if err != nil {
-		return nil, fmt.Errorf("error opening modbus connection: %w", err)
+		return nil, fmt.Errorf("error opening modbus connection to %s: %w", cfg.URL, err)
 	}
 	return &ModbusDevice{modbus: client}, nil
 }
@@ -49,9 +48,9 @@ func (c *ModbusDevice) ReadRegisters(address, quantity uint16) ([]uint16, error)
 	}
 	regs, err := c.modbus.ReadRegisters(address, quantity, modbus.HOLDING_REGISTER)
 	if err != nil {
-		log.Printf("failed to read registers addr=%d, qty=%d: %v", address, quantity, err)
+		return nil, fmt.Errorf("error reading registers addr=%d, qty=%d: %w", address, quantity, classifyError(err))
 	}
-	return regs, err
+	return regs, nil
 }
 
 func (c *ModbusDevice) Close() error {
@@ -68,14 +67,80 @@ func (c *ModbusDevice) SetRegister(address, value uint16) error {
 
 	err := c.modbus.WriteRegister(address, value)
 	if err != nil {
-		return fmt.Errorf("error writing registersers addr=%d, value:%d: %v", address, value, err)
+		return fmt.Errorf("error writing register addr=%d, value:%d: %w", address, value, classifyError(err))
 	}
 
 	return nil
 }
 
-func (m *ModbusDevice) SetRegisters(startAddr uint16, values []uint16) error {
-	return errors.New("not implemented")
+// SetRegisters writes the values to consecutive registers starting at startAddr (function code 16).  Blocks longer
+// than MaxWriteRegisters are split into several requests, so a failure may leave the earlier chunks written.
+func (c *ModbusDevice) SetRegisters(startAddr uint16, values []uint16) error {
+	if c.modbus == nil {
+		return fmt.Errorf("modbus client is nil")
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("no values to write at addr=%d", startAddr)
+	}
+	if int(startAddr)+len(values) > 0x10000 {
+		return fmt.Errorf("write exceeds register space: addr=%d, qty=%d", startAddr, len(values))
+	}
+
+	for offset := 0; offset < len(values); offset += MaxWriteRegisters {
+		end := min(offset+MaxWriteRegisters, len(values))
+		addr := startAddr + uint16(offset)
+
+		err := c.modbus.WriteRegisters(addr, values[offset:end])
+		if err != nil {
+			return fmt.Errorf("error writing registers addr=%d, qty=%d: %w", addr, end-offset, classifyError(err))
+		}
+	}
+
+	return nil
+}
+
+// SetRegistersVerified writes the values like SetRegisters and reads them back afterwards.  Registers which do not
+// hold the written value are reported in a *ReadBackError.
+func (c *ModbusDevice) SetRegistersVerified(startAddr uint16, values []uint16) error {
+	if err := c.SetRegisters(startAddr, values); err != nil {
+		return err
+	}
+	return VerifyRegisters(c, startAddr, values)
+}
+
+// VerifyRegisters reads the registers starting at startAddr in chunks of MaxReadRegisters and compares them with the
+// expected values.  Any difference is returned as a *ReadBackError.
+func VerifyRegisters(client Modbus, startAddr uint16, values []uint16) error {
+	var mismatches []WriteMismatchError
+
+	for offset := 0; offset < len(values); offset += MaxReadRegisters {
+		end := min(offset+MaxReadRegisters, len(values))
+		addr := startAddr + uint16(offset)
+
+		regs, err := client.ReadRegisters(addr, uint16(end-offset))
+		if err != nil {
+			return fmt.Errorf("error reading back registers addr=%d, qty=%d: %w", addr, end-offset, err)
+		}
+		if len(regs) != end-offset {
+			return fmt.Errorf("error reading back registers addr=%d: %w: expected %d, got %d", addr, ErrInvalidResponseLength,
+				end-offset, len(regs))
+		}
+
+		for i, got := range regs {
+			if want := values[offset+i]; got != want {
+				mismatches = append(mismatches, WriteMismatchError{
+					Address:  addr + uint16(i),
+					Expected: float64(want),
+					Actual:   float64(got),
+				})
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &ReadBackError{Mismatches: mismatches}
+	}
+	return nil
 }
 
 func (c *ModbusDevice) ReadRegister(address uint16) (uint16, error) {
@@ -85,7 +150,7 @@ func (c *ModbusDevice) ReadRegister(address uint16) (uint16, error) {
 
 	val, err := c.modbus.ReadRegister(address, modbus.HOLDING_REGISTER)
 	if err != nil {
-		return ErrVal, fmt.Errorf("error reading registerser addr=%d: %w", address, err)
+		return ErrVal, fmt.Errorf("error reading register addr=%d: %w", address, classifyError(err))
 	}
 
 	return val, nil
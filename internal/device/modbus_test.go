@@ -0,0 +1,203 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+// registerServer is a modbus request handler backed by a register map.  It records the size of every write request so
+// the tests can check how ModbusDevice splits them.  Requests starting at an address in exceptions fail with that error.
+type registerServer struct {
+	mu         sync.Mutex
+	registers  map[uint16]uint16
+	writes     []uint16
+	readOnly   map[uint16]bool
+	exceptions map[uint16]error
+}
+
+func (s *registerServer) HandleCoils(*modbus.CoilsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (s *registerServer) HandleDiscreteInputs(*modbus.DiscreteInputsRequest) ([]bool, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (s *registerServer) HandleInputRegisters(*modbus.InputRegistersRequest) ([]uint16, error) {
+	return nil, modbus.ErrIllegalFunction
+}
+
+func (s *registerServer) HandleHoldingRegisters(req *modbus.HoldingRegistersRequest) ([]uint16, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.exceptions[req.Addr]; err != nil {
+		return nil, err
+	}
+
+	if req.IsWrite {
+		s.writes = append(s.writes, req.Quantity)
+		for i, v := range req.Args {
+			addr := req.Addr + uint16(i)
+			if !s.readOnly[addr] {
+				s.registers[addr] = v
+			}
+		}
+		return nil, nil
+	}
+
+	res := make([]uint16, req.Quantity)
+	for i := range res {
+		res[i] = s.registers[req.Addr+uint16(i)]
+	}
+	return res, nil
+}
+
+// startModbusServer runs a modbus TCP server on a free local port and returns a ModbusDevice connected to it.
+func startModbusServer(t *testing.T, handler modbus.RequestHandler) *ModbusDevice {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	url := fmt.Sprintf("tcp://%s", l.Addr())
+	_ = l.Close()
+
+	server, err := modbus.NewServer(&modbus.ServerConfiguration{URL: url, Timeout: time.Second, MaxClients: 2}, handler)
+	if err != nil {
+		t.Fatalf("failed to create modbus server: %v", err)
+	}
+	if err := server.Start(); err != nil {
+		t.Fatalf("failed to start modbus server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = server.Stop()
+	})
+
+	dev, err := NewModbusDevice(&Configuration{URL: url, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("failed to connect to modbus server: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = dev.Close()
+	})
+	return dev
+}
+
+func TestModbusDevice_SetRegisters(t *testing.T) {
+	tests := []struct {
+		name   string
+		count  int
+		writes []uint16
+	}{
+		{name: "single request", count: 32, writes: []uint16{32}},
+		{name: "exactly the limit", count: MaxWriteRegisters, writes: []uint16{MaxWriteRegisters}},
+		{name: "chunked", count: 300, writes: []uint16{MaxWriteRegisters, MaxWriteRegisters, 54}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &registerServer{registers: make(map[uint16]uint16)}
+			dev := startModbusServer(t, handler)
+
+			values := make([]uint16, tt.count)
+			for i := range values {
+				values[i] = uint16(i + 1)
+			}
+
+			if err := dev.SetRegisters(RegProfSegmentStart, values); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			handler.mu.Lock()
+			defer handler.mu.Unlock()
+			if fmt.Sprint(handler.writes) != fmt.Sprint(tt.writes) {
+				t.Errorf("expected write requests %v, got %v", tt.writes, handler.writes)
+			}
+			for i, want := range values {
+				if got := handler.registers[RegProfSegmentStart+uint16(i)]; got != want {
+					t.Fatalf("register %d: expected %d, got %d", RegProfSegmentStart+i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestModbusDevice_SetRegistersVerified(t *testing.T) {
+	handler := &registerServer{
+		registers: map[uint16]uint16{1101: 7, 1104: 9},
+		readOnly:  map[uint16]bool{1101: true, 1104: true},
+	}
+	dev := startModbusServer(t, handler)
+
+	err := dev.SetRegistersVerified(1100, []uint16{1, 2, 3, 4, 5})
+
+	var rbErr *ReadBackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("expected ReadBackError, got %v", err)
+	}
+	expected := []WriteMismatchError{{Address: 1101, Expected: 2, Actual: 7}, {Address: 1104, Expected: 5, Actual: 9}}
+	if !slices.Equal(rbErr.Mismatches, expected) || !errors.Is(err, ErrWriteMismatch) {
+		t.Errorf("expected mismatches %v, got %v", expected, rbErr.Mismatches)
+	}
+}
+
+func TestVerifyRegisters(t *testing.T) {
+	mock := NewMockModbus()
+	values := make([]uint16, 200)
+	for i := range values {
+		values[i] = uint16(i)
+	}
+	_ = mock.SetRegisters(0, values)
+
+	if err := VerifyRegisters(mock, 0, values); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_ = mock.SetRegister(150, 9999)
+	err := VerifyRegisters(mock, 0, values)
+
+	var rbErr *ReadBackError
+	if !errors.As(err, &rbErr) {
+		t.Fatalf("expected ReadBackError, got %v", err)
+	}
+	if len(rbErr.Mismatches) != 1 || rbErr.Mismatches[0].Address != 150 {
+		t.Errorf("expected a single mismatch at 150, got %v", rbErr.Mismatches)
+	}
+}
+
+func TestModbusDevice_Exceptions(t *testing.T) {
+	handler := &registerServer{
+		registers: make(map[uint16]uint16),
+		exceptions: map[uint16]error{
+			RegProfSegmentStart: modbus.ErrIllegalDataAddress,
+			RegSP:               modbus.ErrServerDeviceBusy,
+		},
+	}
+	dev := startModbusServer(t, handler)
+
+	_, err := dev.ReadRegisters(RegProfSegmentStart, 2)
+	var exErr *ExceptionError
+	if !errors.As(err, &exErr) || exErr.Code != ExIllegalDataAddress {
+		t.Errorf("expected illegal data address exception, got %v", err)
+	}
+	if IsTransient(err) {
+		t.Errorf("expected %v not to be transient", err)
+	}
+
+	err = dev.SetRegister(RegSP, 100)
+	if !errors.Is(err, ErrDeviceBusy) || !errors.Is(err, ErrException) {
+		t.Errorf("expected device busy exception, got %v", err)
+	}
+	if !IsTransient(err) {
+		t.Errorf("expected %v to be transient", err)
+	}
+}
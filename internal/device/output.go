@@ -0,0 +1,131 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// ControlMode selects what drives the outputs.
+type ControlMode uint16
+
+const (
+	ModeAuto   ControlMode = iota // the control loop
+	ModeManual                    // the output power written by the user, open loop
+)
+
+func (m ControlMode) String() string {
+	switch m {
+	case ModeAuto:
+		return "AUTO"
+	case ModeManual:
+		return "MANUAL"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", m)
+	}
+}
+
+var ErrNotManual = errors.New("controller not in manual mode")
+
+// OutputPower is the power the controller drives its outputs with, in percent.
+type OutputPower struct {
+	Out1 float64     `json:"out1"` // negative when a heat/cool controller drives Out2
+	Out2 float64     `json:"out2"`
+	Mode ControlMode `json:"mode"`
+}
+
+func (o OutputPower) String() string {
+	return fmt.Sprintf("Out1: %.1f%%, Out2: %.1f%%, Mode: %s", o.Out1, o.Out2, o.Mode)
+}
+
+// ReadOutputPowerContext reads the output power and whether it is set by the control loop or by hand.
+func (p *Pxu) ReadOutputPowerContext(ctx context.Context) (*OutputPower, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	const count = RegControlMode - RegOut1Power + 1
+
+	regs, err := p.readRegistersWithRetry(ctx, RegOut1Power, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading output power from unit %d: %w", p.id, err)
+	}
+
+	return &OutputPower{
+		Out1: decodeRegister(regs, RegOut1Power, "op1", p.Scale()),
+		Out2: decodeRegister(regs, RegOut1Power, "op2", p.Scale()),
+		Mode: ControlMode(regs[RegControlMode-RegOut1Power]),
+	}, nil
+}
+
+// ReadOutputPower calls ReadOutputPowerContext with a background context.
+func (p *Pxu) ReadOutputPower() (*OutputPower, error) {
+	return p.ReadOutputPowerContext(context.Background())
+}
+
+// SetControlModeContext switches between the control loop and manual output.  The controller keeps the output power
+// it had when switching to manual, until SetManualOutputContext changes it.
+func (p *Pxu) SetControlModeContext(ctx context.Context, mode ControlMode) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if mode > ModeManual {
+		return fmt.Errorf("invalid control mode %d", mode)
+	}
+	if err := p.writeRegister(ctx, RegControlMode, uint16(mode)); err != nil {
+		return fmt.Errorf("failed switching unit %d to %s mode: %w", p.id, mode, err)
+	}
+
+	log.Printf("switched unit %d to %s mode", p.id, mode)
+	return nil
+}
+
+// SetControlMode calls SetControlModeContext with a background context.
+func (p *Pxu) SetControlMode(mode ControlMode) error {
+	return p.SetControlModeContext(context.Background(), mode)
+}
+
+// SetManualOutputContext sets the output power in percent while the controller is in manual mode, e.g. 100 to run a
+// kettle element flat out for a boil.  Negative values drive Out2 and need a model with it.  A controller in auto
+// mode ignores the output power, so the write is refused with ErrNotManual.
+func (p *Pxu) SetManualOutputContext(ctx context.Context, percent float64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	r := mustLookupRegister("op1")
+	value, err := r.Encode(percent, p.Scale())
+	if err != nil {
+		return fmt.Errorf("invalid manual output: %w", err)
+	}
+	if percent < 0 {
+		if err := p.require(FeatureOut2); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	regs, err := p.readRegistersWithRetry(ctx, RegControlMode, 1)
+	if err != nil {
+		return fmt.Errorf("failed reading control mode from unit %d: %w", p.id, err)
+	}
+	if mode := ControlMode(regs[0]); mode != ModeManual {
+		return fmt.Errorf("%w: unit %d is in %s mode", ErrNotManual, p.id, mode)
+	}
+
+	if err := p.writeRegister(ctx, r.Address, value); err != nil {
+		return fmt.Errorf("failed setting manual output on unit %d: %w", p.id, err)
+	}
+
+	log.Printf("set manual output on unit %d to %.1f%%", p.id, percent)
+	return nil
+}
+
+// SetManualOutput calls SetManualOutputContext with a background context.
+func (p *Pxu) SetManualOutput(percent float64) error {
+	return p.SetManualOutputContext(context.Background(), percent)
+}
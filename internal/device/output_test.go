@@ -0,0 +1,132 @@
+package device
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPxu_ReadOutputPower(t *testing.T) {
+	tests := []struct {
+		name     string
+		regs     []uint16
+		expected OutputPower
+	}{
+		{"heating", []uint16{755, 0}, OutputPower{Out1: 75.5, Out2: 0, Mode: ModeAuto}},
+		{"cooling", []uint16{0xFE0C, 500}, OutputPower{Out1: -50, Out2: 50, Mode: ModeAuto}},
+		{"manual", []uint16{1000, 0}, OutputPower{Out1: 100, Out2: 0, Mode: ModeManual}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			_ = mock.SetRegisters(RegOut1Power, tt.regs)
+			_ = mock.SetRegister(RegControlMode, uint16(tt.expected.Mode))
+
+			pxu, err := NewPxu(1, mock, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			got, err := pxu.ReadOutputPower()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPxu_SetManualOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     ControlMode
+		features []Feature // capabilities detected when not nil
+		percent  float64
+		expected uint16
+		fails    bool
+		err      error // the error matched, when it is a sentinel
+	}{
+		{"boil", ModeManual, nil, 100, 1000, false, nil},
+		{"off", ModeManual, nil, 0, 0, false, nil},
+		{"cooling", ModeManual, []Feature{FeatureOut2}, -25.5, 0xFF01, false, nil},
+		{"auto mode", ModeAuto, nil, 100, 0, true, ErrNotManual},
+		{"no Out2", ModeManual, []Feature{FeatureAlarms}, -10, 0, true, ErrUnsupported},
+		{"above range", ModeManual, nil, 100.1, 0, true, nil},
+		{"below range", ModeManual, nil, -100.1, 0, true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &writeCountingModbus{MockModbus: NewMockModbus()}
+			_ = mock.MockModbus.SetRegister(RegControlMode, uint16(tt.mode))
+			_ = mock.MockModbus.SetRegisters(RegInfoStart, infoRegisters("PXU41", 123))
+
+			pxu, err := NewPxu(1, mock, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+			if tt.features != nil {
+				registry := CapabilityRegistry
+				defer func() { CapabilityRegistry = registry }()
+				CapabilityRegistry = []CapabilityRule{{Model: "PXU*", Features: tt.features}}
+
+				if _, err := pxu.DetectCapabilities(); err != nil {
+					t.Fatalf("failed to detect capabilities: %v", err)
+				}
+			}
+
+			err = pxu.SetManualOutput(tt.percent)
+			if tt.fails {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("expected error %v, got %v", tt.err, err)
+				}
+				if mock.writes != 0 {
+					t.Errorf("expected no writes, got %d", mock.writes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if reg, _ := mock.ReadRegister(RegOut1Power); reg != tt.expected {
+				t.Errorf("expected output power register 0x%04X, got 0x%04X", tt.expected, reg)
+			}
+		})
+	}
+}
+
+func TestPxu_SetControlMode(t *testing.T) {
+	mock := NewMockModbus()
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	if err := pxu.SetControlMode(ModeManual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reg, _ := mock.ReadRegister(RegControlMode); ControlMode(reg) != ModeManual {
+		t.Errorf("expected %s, got %s", ModeManual, ControlMode(reg))
+	}
+	if err := pxu.SetManualOutput(100); err != nil {
+		t.Errorf("unexpected error after switching to manual: %v", err)
+	}
+
+	if err := pxu.SetControlMode(ModeAuto); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.SetManualOutput(100); !errors.Is(err, ErrNotManual) {
+		t.Errorf("expected ErrNotManual after switching to auto, got %v", err)
+	}
+
+	if err := pxu.SetControlMode(ModeManual + 1); err == nil {
+		t.Error("expected error for an invalid mode")
+	}
+}
@@ -1,18 +1,38 @@
 package device
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"slices"
+	"sync"
 	"time"
 )
 
+var ErrSegmentNotAdvanced = errors.New("segment not advanced")
+
 type UnitId uint8
 
+// Pxu is safe for use by multiple goroutines.  Its transactions go through a request queue, where writes are sent
+// before waiting reads, see Priority.  Operations made of several transactions, like writing a profile, do not
+// interleave with each other.
 type Pxu struct {
 	client  Modbus
 	timeout time.Duration
-	retries int
 	id      UnitId
+	queue   requestQueue
+	seq     chan struct{} // held by multi-step operations
+
+	mu       sync.RWMutex
+	policy   RetryPolicy
+	breaker  *CircuitBreaker
+	cache    *registerCache
+	caps     *Capabilities
+	guard    *setpointGuard
+	verifier *writeVerifier
+	scale    Scale
 }
 
 func NewPxu(id UnitId, client Modbus, timeout time.Duration, retries int) (*Pxu, error) {
@@ -36,87 +56,421 @@ func NewPxu(id UnitId, client Modbus, timeout time.Duration, retries int) (*Pxu,
 	controller := &Pxu{
 		client:  client,
 		timeout: timeout,
-		retries: retries,
+		policy:  DefaultRetryPolicy(retries),
 		id:      id,
+		seq:     make(chan struct{}, 1),
+		scale:   DefaultScale,
 	}
 	return controller, nil
 }
 
-func (p *Pxu) readRegistersWithRetry(addr, count uint16) ([]uint16, error) {
+// withTimeout bounds an operation by the timeout of the Pxu, unless ctx already ends earlier.
+func (p *Pxu) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+// SetRetryPolicy replaces the policy used for repeating failed requests.
+func (p *Pxu) SetRetryPolicy(policy RetryPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return fmt.Errorf("invalid retry policy: %w", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.policy = policy
+	return nil
+}
+
+// EnableCircuitBreaker makes requests fail fast with ErrCircuitOpen once threshold consecutive attempts failed with a
+// transient error.  The unit is probed every probeInterval until it answers again.
+func (p *Pxu) EnableCircuitBreaker(threshold int, probeInterval time.Duration) error {
+	breaker, err := NewCircuitBreaker(threshold, probeInterval, func() error {
+		// the probe takes its turn behind the other requests on the bus
+		ctx, cancel := p.withTimeout(context.Background())
+		defer cancel()
+
+		err := p.queue.do(ctx, PriorityLow, func() error {
+			_, err := p.client.ReadRegisters(RegPV, 1)
+			return err
+		})
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrTimeout // no turn on the bus is no answer from the unit, the circuit stays open
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("invalid circuit breaker: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.breaker != nil {
+		p.breaker.Stop()
+	}
+	p.breaker = breaker
+	return nil
+}
+
+// EnableCache keeps the results of register reads for ttl and merges identical reads in flight, so several clients
+// polling the same registers share one bus transaction.  Writes through the Pxu drop the results they affect.  A ttl
+// of zero disables the cache.
+func (p *Pxu) EnableCache(ttl time.Duration) error {
+	if ttl < 0 {
+		return fmt.Errorf("cache ttl must not be negative, got %v", ttl)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cache = nil
+	if ttl > 0 {
+		p.cache = newRegisterCache(ttl)
+	}
+	return nil
+}
+
+// CacheStats returns how many reads the cache served, zero when it is disabled.
+func (p *Pxu) CacheStats() CacheStats {
+	if cache := p.registerCache(); cache != nil {
+		return cache.snapshot()
+	}
+	return CacheStats{}
+}
+
+func (p *Pxu) registerCache() *registerCache {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cache
+}
+
+// QueueStats returns the depth and wait times of the request queue.
+func (p *Pxu) QueueStats() QueueStats {
+	return p.queue.snapshot()
+}
+
+// lockSequence keeps other multi-step operations from interleaving with the one of the caller, until the returned
+// function is called.
+func (p *Pxu) lockSequence(ctx context.Context) (func(), error) {
+	select {
+	case p.seq <- struct{}{}:
+		return func() { <-p.seq }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// settings returns the retry policy and circuit breaker in use.
+func (p *Pxu) settings() (RetryPolicy, *CircuitBreaker) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policy, p.breaker
+}
+
+// retry queues the request at the given priority until it succeeds, fails with an error which is not transient, or
+// the retry policy gives up.  The queue is not held during the backoff.
+func (p *Pxu) retry(ctx context.Context, priority Priority, request func() error) error {
+	policy, breaker := p.settings()
+	started := time.Now()
 	var lastErr error
 
-	for attempt := 0; attempt <= p.retries; attempt++ {
+	for attempt := 0; attempt <= policy.Retries; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff
-			backoff := time.Duration(attempt) * 100 * time.Millisecond
-			time.Sleep(backoff)
+			backoff := policy.Backoff(attempt)
+			if policy.MaxElapsed > 0 && time.Since(started)+backoff > policy.MaxElapsed {
+				return fmt.Errorf("gave up after %d attempts in %v: %w", attempt, time.Since(started), lastErr)
+			}
+			if err := sleepContext(ctx, backoff); err != nil {
+				return fmt.Errorf("gave up after %d attempts: %w", attempt, errors.Join(err, lastErr))
+			}
 		}
 
-		regs, err := p.client.ReadRegisters(addr, count)
-		if err == nil {
-			return regs, nil
+		// the transaction itself cannot be interrupted, but there is no point starting one nobody waits for
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if breaker != nil {
+			if err := breaker.Allow(); err != nil {
+				return fmt.Errorf("unit %d: %w", p.id, err)
+			}
+		}
+
+		err := p.queue.do(ctx, priority, request)
+		if breaker != nil && ctx.Err() == nil {
+			breaker.Record(err)
+		}
+		if err == nil || !IsTransient(err) {
+			return err
 		}
 		lastErr = err
 	}
 
-	return nil, fmt.Errorf("failed after %d retries: %w", p.retries, lastErr)
+	return fmt.Errorf("failed after %d retries: %w", policy.Retries, lastErr)
+}
+
+// readRegistersWithRetry reads the registers according to the retry policy, through the cache when it is enabled.  A
+// response with the wrong number of registers counts as a transient failure.
+func (p *Pxu) readRegistersWithRetry(ctx context.Context, addr, count uint16) ([]uint16, error) {
+	if cache := p.registerCache(); cache != nil {
+		return cache.read(ctx, addr, count, func() ([]uint16, error) {
+			// shared with the reads merged onto it, so the caller giving up must not fail them
+			shared, cancel := p.withTimeout(context.WithoutCancel(ctx))
+			defer cancel()
+			return p.readRegisters(shared, addr, count)
+		})
+	}
+	return p.readRegisters(ctx, addr, count)
+}
+
+func (p *Pxu) readRegisters(ctx context.Context, addr, count uint16) ([]uint16, error) {
+	var regs []uint16
+	err := p.retry(ctx, priorityFrom(ctx, PriorityNormal), func() error {
+		var err error
+		regs, err = p.client.ReadRegisters(addr, count)
+		if err == nil && len(regs) != int(count) {
+			err = fmt.Errorf("%w: expected %d registers, got %d", ErrInvalidResponseLength, count, len(regs))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+// writeRegister writes the register according to the retry policy.  Writing a value is idempotent, the one exception
+// being commands which act on every write, see writeRegisterOnce.  In write-verify mode the value is read back, see
+// EnableWriteVerify.
+func (p *Pxu) writeRegister(ctx context.Context, addr, value uint16) error {
+	defer p.invalidate(addr, 1)
+
+	return p.verifyWrite(ctx, addr, []uint16{value}, func() error {
+		return p.retry(ctx, priorityFrom(ctx, PriorityHigh), func() error {
+			return p.client.SetRegister(addr, value)
+		})
+	})
+}
+
+// writeRegisterOnce sends the write a single time.  A timeout does not tell whether the device acted on it, so a
+// command like advancing the profile must not be repeated.
+func (p *Pxu) writeRegisterOnce(ctx context.Context, addr, value uint16) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer p.invalidate(addr, 1)
+
+	_, breaker := p.settings()
+	if breaker != nil {
+		if err := breaker.Allow(); err != nil {
+			return fmt.Errorf("unit %d: %w", p.id, err)
+		}
+	}
+
+	err := p.queue.do(ctx, priorityFrom(ctx, PriorityHigh), func() error {
+		return p.client.SetRegister(addr, value)
+	})
+	if breaker != nil && ctx.Err() == nil {
+		breaker.Record(err)
+	}
+	return err
+}
+
+func (p *Pxu) writeRegisters(ctx context.Context, addr uint16, values []uint16) error {
+	defer p.invalidate(addr, len(values))
+
+	return p.verifyWrite(ctx, addr, values, func() error {
+		return p.retry(ctx, priorityFrom(ctx, PriorityHigh), func() error {
+			return p.client.SetRegisters(addr, values)
+		})
+	})
+}
+
+// invalidate drops the cached results covering the registers written, also when the write failed, as the device may
+// have taken it anyway.
+func (p *Pxu) invalidate(addr uint16, count int) {
+	if cache := p.registerCache(); cache != nil {
+		cache.invalidate(addr, count)
+	}
+}
+
+// sleepContext waits for the duration, returning early with the context error when ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 func (p *Pxu) Close() error {
+	if _, breaker := p.settings(); breaker != nil {
+		breaker.Stop()
+	}
 	if p.client != nil {
 		return p.client.Close()
 	}
 	return fmt.Errorf("no client to close")
 }
 
-func (p *Pxu) ReadStats() (*Stats, error) {
+func (p *Pxu) ReadStatsContext(ctx context.Context) (*Stats, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
 	const totalRegisters = 30
 
-	regs, err := p.readRegistersWithRetry(0, totalRegisters)
+	regs, err := p.readRegistersWithRetry(ctx, 0, totalRegisters)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading registers from unit %d: %w", p.id, err)
 	}
 
-	// ensure we received all the requested registers
-	if len(regs) < totalRegisters {
-		return nil, fmt.Errorf("insufficient registers received: expected %d, got %d", totalRegisters, len(regs))
+	return NewStats(regs, p.Scale())
+}
+
+// ReadStats calls ReadStatsContext with a background context.
+func (p *Pxu) ReadStats() (*Stats, error) {
+	return p.ReadStatsContext(context.Background())
+}
+
+// ReadScaleContext reads the input type and decimal point configuration of the device and uses it to decode and encode
+// process values from then on.  Until it is called, DefaultScale is assumed.
+func (p *Pxu) ReadScaleContext(ctx context.Context) (Scale, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	regs, err := p.readRegistersWithRetry(ctx, RegInputType, InputRegCount)
+	if err != nil {
+		return Scale{}, fmt.Errorf("failed reading input configuration from unit %d: %w", p.id, err)
+	}
+
+	scale, err := NewScale(regs[RegInputType-RegInputType], regs[RegDecimalPoint-RegInputType])
+	if err != nil {
+		return Scale{}, fmt.Errorf("invalid input configuration on unit %d: %w", p.id, err)
 	}
 
-	return NewStats(regs)
+	p.mu.Lock()
+	p.scale = scale
+	p.mu.Unlock()
+	return scale, nil
 }
 
-func (p *Pxu) ReadInfo() (*Info, error) {
-	regs, err := p.readRegistersWithRetry(RegInfoStart, InfoRegCount)
+// ReadScale calls ReadScaleContext with a background context.
+func (p *Pxu) ReadScale() (Scale, error) {
+	return p.ReadScaleContext(context.Background())
+}
+
+// Scale returns the scaling used for process values.
+func (p *Pxu) Scale() Scale {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.scale
+}
+
+func (p *Pxu) ReadInfoContext(ctx context.Context) (*Info, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	regs, err := p.readRegistersWithRetry(ctx, RegInfoStart, InfoRegCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading registers from unit %d: %w", p.id, err)
 	}
 
-	if len(regs) < InfoRegCount {
-		return nil, fmt.Errorf("insufficient registers received: expected %d, got %d", InfoRegCount, len(regs))
+	return NewInfo(regs)
+}
+
+// ReadInfo calls ReadInfoContext with a background context.
+func (p *Pxu) ReadInfo() (*Info, error) {
+	return p.ReadInfoContext(context.Background())
+}
+
+// DetectCapabilitiesContext reads the model and firmware of the device and looks up its features.  From then on,
+// operations needing a feature the device does not have fail with an *UnsupportedError instead of writing to
+// registers which do not exist.  Until it is called, every operation is allowed.
+func (p *Pxu) DetectCapabilitiesContext(ctx context.Context) (*Capabilities, error) {
+	info, err := p.ReadInfoContext(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return NewInfo(regs)
+	caps, err := NewCapabilities(*info)
+	if err != nil {
+		return nil, fmt.Errorf("unit %d: %w", p.id, err)
+	}
+
+	p.mu.Lock()
+	p.caps = caps
+	p.mu.Unlock()
+	return caps, nil
+}
+
+// DetectCapabilities calls DetectCapabilitiesContext with a background context.
+func (p *Pxu) DetectCapabilities() (*Capabilities, error) {
+	return p.DetectCapabilitiesContext(context.Background())
+}
+
+// Capabilities returns the features of the device, nil until they were detected.
+func (p *Pxu) Capabilities() *Capabilities {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.caps
+}
+
+// require fails with an *UnsupportedError when the device is known not to have the feature.
+func (p *Pxu) require(feature Feature) error {
+	caps := p.Capabilities()
+	if caps == nil || caps.Has(feature) {
+		return nil
+	}
+	return &UnsupportedError{Unit: p.id, Model: caps.Model, Feature: feature}
+}
+
+func (p *Pxu) ReadProfileContext(ctx context.Context, id uint16) (*Profile, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return nil, err
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return p.readProfile(ctx, id)
 }
 
+// ReadProfile calls ReadProfileContext with a background context.
 func (p *Pxu) ReadProfile(id uint16) (*Profile, error) {
-	if id > 16 {
+	return p.ReadProfileContext(context.Background(), id)
+}
+
+// readProfile reads the profile without taking the sequence lock.
+func (p *Pxu) readProfile(ctx context.Context, id uint16) (*Profile, error) {
+	if id >= MaxProfiles {
 		return nil, fmt.Errorf("invalid profile id selected: %d", id)
 	}
 
 	// read the number of segments this profile spans
-	segmentCount, err := p.readRegistersWithRetry(RegNumSegments+id, 1)
+	segmentCount, err := p.readRegistersWithRetry(ctx, RegNumSegments+id, 1)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading profile segment count from unit %d: %w", p.id, err)
 	}
 
 	// read whether the profile stops, ends or continues with another one
-	linkProfile, err := p.readRegistersWithRetry(RegProfLink+id, 1)
+	linkProfile, err := p.readRegistersWithRetry(ctx, RegProfLink+id, 1)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading linked profile from unit %d: %w", p.id, err)
 	}
 
 	// read how often the profile repeats
-	repeatCycle, err := p.readRegistersWithRetry(RegProfCycleRepeat+id, 1)
+	repeatCycle, err := p.readRegistersWithRetry(ctx, RegProfCycleRepeat+id, 1)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading profile cycle count from unit %d: %w", p.id, err)
 	}
@@ -124,59 +478,763 @@ func (p *Pxu) ReadProfile(id uint16) (*Profile, error) {
 	sc := segmentCount[0] + 1 // count of zero actually means one segment only
 	profile := NewProfile(id, sc, linkProfile[0], repeatCycle[0])
 
-	start := id*32 + RegProfSegmentStart
+	start := id*ProfileRegStride + RegProfSegmentStart
 	count := profile.SegCount * 2
-	regs, err := p.readRegistersWithRetry(start, count)
+	regs, err := p.readRegistersWithRetry(ctx, start, count)
 	if err != nil {
 		return nil, fmt.Errorf("failed reading profile from unit %d: %w", p.id, err)
 	}
 
-	fillProfile(profile, regs)
+	fillProfile(profile, regs, p.Scale())
+
+	profile.Settings, err = p.readProfileSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
 	return profile, nil
 }
 
-func fillProfile(profile *Profile, regs []uint16) {
+// ReadProfileSettingsContext reads the settings shared by every profile.
+func (p *Pxu) ReadProfileSettingsContext(ctx context.Context) (*ProfileSettings, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return nil, err
+	}
+	return p.readProfileSettings(ctx)
+}
+
+// ReadProfileSettings calls ReadProfileSettingsContext with a background context.
+func (p *Pxu) ReadProfileSettings() (*ProfileSettings, error) {
+	return p.ReadProfileSettingsContext(context.Background())
+}
+
+func (p *Pxu) readProfileSettings(ctx context.Context) (*ProfileSettings, error) {
+	regs, err := p.readRegistersWithRetry(ctx, RegProfDEV, ProfileSettingsRegCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading profile settings from unit %d: %w", p.id, err)
+	}
+	return newProfileSettings(regs, p.Scale()), nil
+}
+
+// WriteProfileSettingsContext writes the settings shared by every profile, e.g. a guaranteed soak band so a mash
+// rest does not start counting before the mash is at temperature.
+func (p *Pxu) WriteProfileSettingsContext(ctx context.Context, settings *ProfileSettings) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+	if settings == nil {
+		return fmt.Errorf("profile settings are nil")
+	}
+
+	regs, err := settings.encode(p.Scale())
+	if err != nil {
+		return fmt.Errorf("invalid profile settings: %w", err)
+	}
+	if err := p.writeRegisters(ctx, RegProfDEV, regs); err != nil {
+		return fmt.Errorf("failed writing profile settings to unit %d: %w", p.id, err)
+	}
+	return nil
+}
+
+// WriteProfileSettings calls WriteProfileSettingsContext with a background context.
+func (p *Pxu) WriteProfileSettings(settings *ProfileSettings) error {
+	return p.WriteProfileSettingsContext(context.Background(), settings)
+}
+
+func fillProfile(profile *Profile, regs []uint16, scale Scale) {
+	sp, t := mustLookupRegister("segsp[0]"), mustLookupRegister("segtime[0]")
+
 	// setpoint -> even idx, time -> odd idx
 	for i := uint16(0); i < profile.SegCount; i++ {
 		p := i * 2
 		seg := Segment{
 			Id: uint8(i),
-			Sp: toFloat(regs[p]),
-			T:  toFloat(regs[p+1]),
+			Sp: sp.Decode(regs[p], scale),
+			T:  t.Decode(regs[p+1], scale),
 		}
 		profile.Segments = append(profile.Segments, seg)
 	}
 }
 
-func (p *Pxu) UpdateSetpoint(value float64) error {
-	err := p.client.SetRegister(RegSP, toUint16(value))
+// WriteProfileContext programs the profile into the device.  The settings, unless nil, and the segments are written
+// first, followed by the segment count, the cycle repeat and the link, so the profile never points at segments which
+// have not been written yet.  Afterwards the profile is read back to confirm the device took every value.
+func (p *Pxu) WriteProfileContext(ctx context.Context, profile *Profile) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	if err := validateProfile(profile); err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+	if err := p.checkSegments(ctx, profile); err != nil {
+		return err
+	}
+
+	scale := p.Scale()
+	regs, err := encodeSegments(profile.Segments, scale)
+	if err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+
+	var settings []uint16
+	if profile.Settings != nil {
+		if settings, err = profile.Settings.encode(scale); err != nil {
+			return fmt.Errorf("invalid profile settings: %w", err)
+		}
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if settings != nil {
+		if err := p.writeRegisters(ctx, RegProfDEV, settings); err != nil {
+			return fmt.Errorf("failed writing profile settings to unit %d: %w", p.id, err)
+		}
+	}
+
+	id := profile.Id
+	start := id*ProfileRegStride + RegProfSegmentStart
+	if err := p.writeRegisters(ctx, start, regs); err != nil {
+		return fmt.Errorf("failed writing profile %d segments to unit %d: %w", id, p.id, err)
+	}
+
+	// a count of zero means one segment
+	if err := p.writeRegister(ctx, RegNumSegments+id, profile.SegCount-1); err != nil {
+		return fmt.Errorf("failed writing profile %d segment count to unit %d: %w", id, p.id, err)
+	}
+
+	if err := p.writeRegister(ctx, RegProfCycleRepeat+id, profile.repeat); err != nil {
+		return fmt.Errorf("failed writing profile %d cycle count to unit %d: %w", id, p.id, err)
+	}
+
+	if err := p.writeRegister(ctx, RegProfLink+id, profile.link); err != nil {
+		return fmt.Errorf("failed writing profile %d link to unit %d: %w", id, p.id, err)
+	}
+
+	written, err := p.readProfile(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed confirming profile %d on unit %d: %w", id, p.id, err)
+	}
+	if err := compareProfiles(profile, written, scale); err != nil {
+		return fmt.Errorf("profile %d not accepted by unit %d: %w", id, p.id, err)
+	}
+
+	log.Printf("wrote profile %d with %d segments to unit %d", id, profile.SegCount, p.id)
+	return nil
+}
+
+// WriteProfile calls WriteProfileContext with a background context.
+func (p *Pxu) WriteProfile(profile *Profile) error {
+	return p.WriteProfileContext(context.Background(), profile)
+}
+
+func validateProfile(profile *Profile) error {
+	if profile == nil {
+		return fmt.Errorf("profile is nil")
+	}
+	if profile.Id >= MaxProfiles {
+		return fmt.Errorf("profile id %d out of range [0, %d]", profile.Id, MaxProfiles-1)
+	}
+	if len(profile.Segments) == 0 || len(profile.Segments) > MaxSegments {
+		return fmt.Errorf("segment count %d out of range [1, %d]", len(profile.Segments), MaxSegments)
+	}
+	if int(profile.SegCount) != len(profile.Segments) {
+		return fmt.Errorf("segment count %d does not match %d segments", profile.SegCount, len(profile.Segments))
+	}
+
+	for i, seg := range profile.Segments {
+		index := int(profile.Id)*MaxSegments + i
+		if err := mustLookupRegister(fmt.Sprintf("segsp[%d]", index)).Validate(seg.Sp); err != nil {
+			return err
+		}
+		if err := mustLookupRegister(fmt.Sprintf("segtime[%d]", index)).Validate(seg.T); err != nil {
+			return err
+		}
+	}
+
+	if profile.link >= MaxProfiles && profile.link != LinkEnd && profile.link != LinkStop {
+		return fmt.Errorf("invalid link target %d", profile.link)
+	}
+	if profile.repeat > MaxCycleRepeat {
+		return fmt.Errorf("cycle repeat %d out of range [0, %d]", profile.repeat, MaxCycleRepeat)
+	}
+
+	return nil
+}
+
+// encodeSegments converts the segments into setpoint/time register pairs.
+func encodeSegments(segments []Segment, scale Scale) ([]uint16, error) {
+	spReg, tReg := mustLookupRegister("segsp[0]"), mustLookupRegister("segtime[0]")
+
+	regs := make([]uint16, 0, 2*len(segments))
+	for i, seg := range segments {
+		sp, err := spReg.Encode(seg.Sp, scale)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, err)
+		}
+		t, err := tReg.Encode(seg.T, scale)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", i, err)
+		}
+		regs = append(regs, sp, t)
+	}
+	return regs, nil
+}
+
+// compareProfiles checks the profile read back from the device against the one written, at register resolution.
+func compareProfiles(want, got *Profile, scale Scale) error {
+	if want.SegCount != got.SegCount {
+		return fmt.Errorf("segment count: want %d, got %d", want.SegCount, got.SegCount)
+	}
+	if want.link != got.link {
+		return fmt.Errorf("link: want %d, got %d", want.link, got.link)
+	}
+	if want.repeat != got.repeat {
+		return fmt.Errorf("cycle repeat: want %d, got %d", want.repeat, got.repeat)
+	}
+	if want.Settings != nil {
+		if err := compareProfileSettings(want.Settings, got.Settings, scale); err != nil {
+			return err
+		}
+	}
+	wantRegs, err := encodeSegments(want.Segments, scale)
+	if err != nil {
+		return err
+	}
+	gotRegs, err := encodeSegments(got.Segments, scale)
+	if err != nil {
+		return err
+	}
+	for i := range wantRegs {
+		if wantRegs[i] != gotRegs[i] {
+			return fmt.Errorf("segment %d: want %v, got %v", i/2, want.Segments[i/2], got.Segments[i/2])
+		}
+	}
+	return nil
+}
+
+func compareProfileSettings(want, got *ProfileSettings, scale Scale) error {
+	if got == nil {
+		return fmt.Errorf("settings: want %v, got none", want)
+	}
+	wantRegs, err := want.encode(scale)
+	if err != nil {
+		return err
+	}
+	gotRegs, err := got.encode(scale)
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(wantRegs, gotRegs) {
+		return fmt.Errorf("settings: want %v, got %v", want, got)
+	}
+	return nil
+}
+
+// UpdateSetpointContext writes the active setpoint.  With a safety envelope, setpoints outside it are refused with an
+// *EnvelopeError unless ctx carries an override, see WithOverride.
+func (p *Pxu) UpdateSetpointContext(ctx context.Context, value float64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	reg, err := mustLookupRegister("sp").Encode(value, p.Scale())
+	if err != nil {
+		return fmt.Errorf("invalid sp %.1f: %w", value, err)
+	}
+
+	guard := p.setpointGuard()
+	if guard != nil {
+		unlock, err := p.lockSequence(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if err := p.checkSetpoint(ctx, guard, value); err != nil {
+			return err
+		}
+	}
+
+	err = p.writeRegister(ctx, RegSP, reg)
 	if err != nil {
 		return fmt.Errorf("failed to update sp to %.1f: %w", value, err)
 	}
+	if guard != nil {
+		guard.record(time.Now())
+	}
 	log.Printf("updated sp to %.1f", value)
 	return nil
 }
 
-func (p *Pxu) UpdateControllerStatus(value uint16) error {
-	err := p.client.SetRegister(RegControllerStatus, value)
-	if err != nil {
+// UpdateSetpoint calls UpdateSetpointContext with a background context.
+func (p *Pxu) UpdateSetpoint(value float64) error {
+	return p.UpdateSetpointContext(context.Background(), value)
+}
+
+func (p *Pxu) UpdateControllerStatusContext(ctx context.Context, value uint16) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	write := p.writeRegister
+	if value == RsAdvance {
+		write = p.writeRegisterOnce
+	}
+	if err := write(ctx, RegControllerStatus, value); err != nil {
 		return fmt.Errorf("failed to update controller status on unit %d: %w", p.id, err)
 	}
 	return nil
 }
 
-func (p *Pxu) Stop() error {
-	if err := p.UpdateControllerStatus(RsStop); err != nil {
+// UpdateControllerStatus calls UpdateControllerStatusContext with a background context.
+func (p *Pxu) UpdateControllerStatus(value uint16) error {
+	return p.UpdateControllerStatusContext(context.Background(), value)
+}
+
+func (p *Pxu) StopContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.UpdateControllerStatusContext(ctx, RsStop); err != nil {
 		return fmt.Errorf("failed to stop unit %d: %w", p.id, err)
 	}
 	log.Printf("stopped unit %d", p.id)
 	return nil
 }
 
-func (p *Pxu) Run() error {
-	if err := p.UpdateControllerStatus(RsStart); err != nil {
+// Stop calls StopContext with a background context.
+func (p *Pxu) Stop() error {
+	return p.StopContext(context.Background())
+}
+
+func (p *Pxu) RunContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.UpdateControllerStatusContext(ctx, RsStart); err != nil {
 		return fmt.Errorf("failed to start unit %d: %w", p.id, err)
 	}
 	log.Printf("started unit %d", p.id)
 	return nil
 }
+
+// Run calls RunContext with a background context.
+func (p *Pxu) Run() error {
+	return p.RunContext(context.Background())
+}
+
+// SelectProfileContext chooses the profile the controller runs when it is started next.
+func (p *Pxu) SelectProfileContext(ctx context.Context, id uint16) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.selectProfile(ctx, id)
+}
+
+// SelectProfile calls SelectProfileContext with a background context.
+func (p *Pxu) SelectProfile(id uint16) error {
+	return p.SelectProfileContext(context.Background(), id)
+}
+
+// selectProfile writes and confirms the profile selection without taking the sequence lock.
+func (p *Pxu) selectProfile(ctx context.Context, id uint16) error {
+	if id >= MaxProfiles {
+		return fmt.Errorf("invalid profile id selected: %d", id)
+	}
+
+	if err := p.writeRegister(ctx, RegPC, id); err != nil {
+		return fmt.Errorf("failed to select profile %d on unit %d: %w", id, p.id, err)
+	}
+
+	regs, err := p.readRegistersWithRetry(ctx, RegPC, 1)
+	if err != nil {
+		return fmt.Errorf("failed confirming profile selection on unit %d: %w", p.id, err)
+	}
+	if regs[0] != id {
+		return fmt.Errorf("unit %d reports profile %d, expected %d", p.id, regs[0], id)
+	}
+	return nil
+}
+
+// StartProfileContext selects the profile and runs it from the given segment.
+func (p *Pxu) StartProfileContext(ctx context.Context, id, segment uint16) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	if segment >= MaxSegments {
+		return fmt.Errorf("invalid segment selected: %d", segment)
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.selectProfile(ctx, id); err != nil {
+		return err
+	}
+
+	if err := p.writeRegister(ctx, RegPS, segment); err != nil {
+		return fmt.Errorf("failed to select segment %d on unit %d: %w", segment, p.id, err)
+	}
+
+	if err := p.changeRunStatus(ctx, Run); err != nil {
+		return fmt.Errorf("failed to start profile %d on unit %d: %w", id, p.id, err)
+	}
+	log.Printf("started profile %d at segment %d on unit %d", id, segment, p.id)
+	return nil
+}
+
+// StartProfile calls StartProfileContext with a background context.
+func (p *Pxu) StartProfile(id, segment uint16) error {
+	return p.StartProfileContext(context.Background(), id, segment)
+}
+
+// PauseProfileContext holds the running profile at its current setpoint.
+func (p *Pxu) PauseProfileContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.changeRunStatus(ctx, Pause); err != nil {
+		return fmt.Errorf("failed to pause profile on unit %d: %w", p.id, err)
+	}
+	log.Printf("paused profile on unit %d", p.id)
+	return nil
+}
+
+// PauseProfile calls PauseProfileContext with a background context.
+func (p *Pxu) PauseProfile() error {
+	return p.PauseProfileContext(context.Background())
+}
+
+// ResumeProfileContext continues a paused profile.
+func (p *Pxu) ResumeProfileContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.changeRunStatus(ctx, Run); err != nil {
+		return fmt.Errorf("failed to resume profile on unit %d: %w", p.id, err)
+	}
+	log.Printf("resumed profile on unit %d", p.id)
+	return nil
+}
+
+// ResumeProfile calls ResumeProfileContext with a background context.
+func (p *Pxu) ResumeProfile() error {
+	return p.ResumeProfileContext(context.Background())
+}
+
+// AdvanceSegmentContext skips the remainder of the current segment.  The controller reports RUN or, depending on the
+// firmware, ADVANCE PROFILE while it runs the next segment, which is confirmed by the profile position changing.
+// Advancing the last segment ends the profile, the controller then reports END or STOP.  A *RunStatusError is
+// returned when no profile is running, ErrSegmentNotAdvanced when the controller stays in the segment.
+func (p *Pxu) AdvanceSegmentContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	before, err := p.readRegisters(ctx, 0, StatsRegCount)
+	if err != nil {
+		return fmt.Errorf("failed reading profile position from unit %d: %w", p.id, err)
+	}
+	if status := RunStatus(before[RegControllerStatus]); status == Stop || status == End {
+		return &RunStatusError{Unit: p.id, Want: Run, Got: status}
+	}
+
+	if err := p.UpdateControllerStatusContext(ctx, uint16(AdvanceProfile)); err != nil {
+		return fmt.Errorf("failed to advance profile on unit %d: %w", p.id, err)
+	}
+
+	after, err := p.readRegisters(ctx, 0, StatsRegCount)
+	if err != nil {
+		return fmt.Errorf("failed reading profile position from unit %d: %w", p.id, err)
+	}
+
+	switch status := RunStatus(after[RegControllerStatus]); {
+	case status == End || status == Stop:
+		log.Printf("advanced past the last segment, profile ended on unit %d", p.id)
+		return nil
+	case status != Run && status != AdvanceProfile:
+		return &RunStatusError{Unit: p.id, Want: AdvanceProfile, Got: status}
+	case after[RegPC] == before[RegPC] && after[RegPS] == before[RegPS]:
+		return fmt.Errorf("unit %d still in segment %d of profile %d: %w",
+			p.id, after[RegPS], after[RegPC], ErrSegmentNotAdvanced)
+	}
+
+	log.Printf("advanced profile on unit %d to segment %d of profile %d", p.id, after[RegPS], after[RegPC])
+	return nil
+}
+
+// AdvanceSegment calls AdvanceSegmentContext with a background context.
+func (p *Pxu) AdvanceSegment() error {
+	return p.AdvanceSegmentContext(context.Background())
+}
+
+// EndProfileContext terminates the running profile.
+func (p *Pxu) EndProfileContext(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := p.require(FeatureProfiles); err != nil {
+		return err
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.changeRunStatus(ctx, End); err != nil {
+		return fmt.Errorf("failed to end profile on unit %d: %w", p.id, err)
+	}
+	log.Printf("ended profile on unit %d", p.id)
+	return nil
+}
+
+// EndProfile calls EndProfileContext with a background context.
+func (p *Pxu) EndProfile() error {
+	return p.EndProfileContext(context.Background())
+}
+
+// changeRunStatus writes the run status and confirms the controller reports it.  A *RunStatusError is returned when
+// it does not.  The caller holds the sequence lock.
+func (p *Pxu) changeRunStatus(ctx context.Context, status RunStatus) error {
+	if err := p.UpdateControllerStatusContext(ctx, uint16(status)); err != nil {
+		return err
+	}
+
+	regs, err := p.readRegistersWithRetry(ctx, RegControllerStatus, 1)
+	if err != nil {
+		return fmt.Errorf("failed reading run status from unit %d: %w", p.id, err)
+	}
+
+	got := RunStatus(regs[0])
+	if got == status {
+		return nil
+	}
+	return &RunStatusError{Unit: p.id, Want: status, Got: got}
+}
+
+// ReadPidContext reads the PID parameter set the controller is currently using.
+func (p *Pxu) ReadPidContext(ctx context.Context) (*PidParameters, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	const count = RegTGroup - RegTP + 1
+
+	regs, err := p.readRegistersWithRetry(ctx, RegTP, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading pid parameters from unit %d: %w", p.id, err)
+	}
+
+	return &PidParameters{
+		Group: regs[RegTGroup-RegTP],
+		TP:    decodeRegister(regs, RegTP, "tp", p.Scale()),
+		TI:    regs[RegTI-RegTP],
+		TD:    regs[RegTD-RegTP],
+	}, nil
+}
+
+// ReadPid calls ReadPidContext with a background context.
+func (p *Pxu) ReadPid() (*PidParameters, error) {
+	return p.ReadPidContext(context.Background())
+}
+
+// SelectPidGroupContext switches the controller to another PID parameter set.
+func (p *Pxu) SelectPidGroupContext(ctx context.Context, group uint16) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if group >= PidGroupCount {
+		return fmt.Errorf("parameter set %d out of range [0, %d]", group, PidGroupCount-1)
+	}
+	if err := p.writeRegister(ctx, RegTGroup, group); err != nil {
+		return fmt.Errorf("failed to select pid parameter set %d on unit %d: %w", group, p.id, err)
+	}
+	return nil
+}
+
+// SelectPidGroup calls SelectPidGroupContext with a background context.
+func (p *Pxu) SelectPidGroup(group uint16) error {
+	return p.SelectPidGroupContext(context.Background(), group)
+}
+
+// WritePidContext switches the controller to the parameter set of params and stores the tuning values in it.  The
+// parameters are read back to confirm the controller accepted them.
+func (p *Pxu) WritePidContext(ctx context.Context, params *PidParameters) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if params == nil {
+		return fmt.Errorf("pid parameters are nil")
+	}
+	if err := params.validate(); err != nil {
+		return fmt.Errorf("invalid pid parameters: %w", err)
+	}
+
+	unlock, err := p.lockSequence(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := p.SelectPidGroupContext(ctx, params.Group); err != nil {
+		return err
+	}
+
+	tp, err := mustLookupRegister("tp").Encode(params.TP, p.Scale())
+	if err != nil {
+		return fmt.Errorf("invalid pid parameters: %w", err)
+	}
+
+	if err := p.writeRegisters(ctx, RegTP, []uint16{tp, params.TI, params.TD}); err != nil {
+		return fmt.Errorf("failed writing pid parameters to unit %d: %w", p.id, err)
+	}
+
+	got, err := p.ReadPidContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed confirming pid parameters on unit %d: %w", p.id, err)
+	}
+	if got.Group != params.Group || math.Abs(got.TP-params.TP) >= 0.05 || got.TI != params.TI || got.TD != params.TD {
+		return fmt.Errorf("pid parameters not accepted by unit %d: want %v, got %v", p.id, params, got)
+	}
+
+	log.Printf("updated pid parameters on unit %d: %v", p.id, params)
+	return nil
+}
+
+// WritePid calls WritePidContext with a background context.
+func (p *Pxu) WritePid(params *PidParameters) error {
+	return p.WritePidContext(context.Background(), params)
+}
+
+// GetContext reads any parameter from the register map by name, e.g. "sp", "tp" or "link[3]".
+func (p *Pxu) GetContext(ctx context.Context, name string) (float64, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	r, err := LookupRegister(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := p.require(r.Feature); err != nil {
+		return 0, err
+	}
+
+	regs, err := p.readRegistersWithRetry(ctx, r.Address, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed reading %s from unit %d: %w", r.Name, p.id, err)
+	}
+
+	return r.Decode(regs[0], p.Scale()), nil
+}
+
+// Get calls GetContext with a background context.
+func (p *Pxu) Get(name string) (float64, error) {
+	return p.GetContext(context.Background(), name)
+}
+
+// SetContext writes any writable parameter from the register map by name.  The value is checked against the range of
+// the register before it is sent.
+func (p *Pxu) SetContext(ctx context.Context, name string, value float64) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	r, err := LookupRegister(name)
+	if err != nil {
+		return err
+	}
+	if r.Access != ReadWrite {
+		return fmt.Errorf("%w: %s", ErrReadOnlyRegister, r.Name)
+	}
+	if err := p.require(r.Feature); err != nil {
+		return err
+	}
+	// setpoints are held to the safety envelope
+	if r.Address == RegSP {
+		return p.UpdateSetpointContext(ctx, value)
+	}
+	// run status commands like advancing the profile must not be repeated
+	if r.Address == RegControllerStatus {
+		return p.UpdateControllerStatusContext(ctx, uint16(value))
+	}
+	if profile, segment, ok := segmentSetpoint(r.Address); ok {
+		if guard := p.setpointGuard(); guard != nil {
+			if err := p.checkSegment(ctx, guard, profile, segment, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	reg, err := r.Encode(value, p.Scale())
+	if err != nil {
+		return err
+	}
+
+	if err := p.writeRegister(ctx, r.Address, reg); err != nil {
+		return fmt.Errorf("failed writing %s to unit %d: %w", r.Name, p.id, err)
+	}
+	log.Printf("updated %s to %v on unit %d", r.Name, value, p.id)
+	return nil
+}
+
+// Set calls SetContext with a background context.
+func (p *Pxu) Set(name string, value float64) error {
+	return p.SetContext(context.Background(), name, value)
+}
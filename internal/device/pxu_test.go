@@ -2,6 +2,9 @@
 package device
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
@@ -76,8 +79,8 @@ func TestNewPxu(t *testing.T) {
 				t.Errorf("expected default timeout %v, got %v", DefaultTimeout, pxu.timeout)
 			}
 
-			if tt.retries == 0 && pxu.retries != DefaultRetries {
-				t.Errorf("expected default retries %d, got %d", DefaultRetries, pxu.retries)
+			if tt.retries == 0 && pxu.policy.Retries != DefaultRetries {
+				t.Errorf("expected default retries %d, got %d", DefaultRetries, pxu.policy.Retries)
 			}
 		})
 	}
@@ -360,6 +363,11 @@ func TestPxu_ReadProfile(t *testing.T) {
 			profileNumber: 17,
 			expectError:   true,
 		},
+		{
+			name:          "first profile number past the last",
+			profileNumber: MaxProfiles,
+			expectError:   true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -453,3 +461,677 @@ func TestPxu_Start(t *testing.T) {
 		})
 	}
 }
+
+// stuckModbus ignores writes to a single register, like a device rejecting a value without raising an exception.
+type stuckModbus struct {
+	*MockModbus
+	stuck uint16
+}
+
+func (m *stuckModbus) SetRegister(address, value uint16) error {
+	if address == m.stuck {
+		return nil
+	}
+	return m.MockModbus.SetRegister(address, value)
+}
+
+func TestPxu_WriteProfile(t *testing.T) {
+	mashProfile := func() *Profile {
+		profile := NewProfile(3, 3, LinkEnd, 1)
+		profile.Segments = []Segment{
+			{Id: 0, Sp: 52.0, T: 15.0},
+			{Id: 1, Sp: 65.3, T: 60.0},
+			{Id: 2, Sp: 78.0, T: 10.5},
+		}
+		profile.Settings = &ProfileSettings{Deviation: 0.5, ErrorBandTime: 5.0, InitialRampRate: 1.5}
+		return profile
+	}
+
+	tests := []struct {
+		name        string
+		client      func(*MockModbus) Modbus
+		profile     func() *Profile
+		expectError bool
+	}{
+		{
+			name:    "successful write",
+			profile: mashProfile,
+		},
+		{
+			name: "linked to another profile",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.link = 4
+				return profile
+			},
+		},
+		{
+			name: "profile id exceeded",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.Id = MaxProfiles
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "segment count mismatch",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.SegCount = 4
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "too many segments",
+			profile: func() *Profile {
+				profile := NewProfile(0, MaxSegments+1, LinkStop, 0)
+				profile.Segments = make([]Segment, MaxSegments+1)
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "negative setpoint",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.Segments[0].Sp = -1.5
+				return profile
+			},
+		},
+		{
+			name: "setpoint out of range",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.Segments[1].Sp = MaxSegmentSp + 0.1
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "time out of range",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.Segments[2].T = -1
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "deviation out of range",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.Settings.Deviation = -1
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid link",
+			profile: func() *Profile {
+				profile := mashProfile()
+				profile.link = 18
+				return profile
+			},
+			expectError: true,
+		},
+		{
+			name: "device does not take the link",
+			client: func(mock *MockModbus) Modbus {
+				return &stuckModbus{MockModbus: mock, stuck: RegProfLink + 3}
+			},
+			profile:     mashProfile,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			var client Modbus = mock
+			if tt.client != nil {
+				client = tt.client(mock)
+			}
+
+			pxu, err := NewPxu(1, client, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			want := tt.profile()
+			err = pxu.WriteProfile(want)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := pxu.ReadProfile(want.Id)
+			if err != nil {
+				t.Fatalf("failed to read profile: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("profile mismatch, want '%v', got '%v'", want, got)
+			}
+		})
+	}
+}
+
+func TestPxu_ProfileSettings(t *testing.T) {
+	mock := NewMockModbus()
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	want := &ProfileSettings{Deviation: 1.0, ErrorBandTime: 2.5, InitialRampRate: 0.5}
+	if err := pxu.WriteProfileSettings(want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	regs, _ := mock.ReadRegisters(RegProfDEV, ProfileSettingsRegCount)
+	if !reflect.DeepEqual(regs, []uint16{10, 25, 5}) {
+		t.Errorf("expected registers [10 25 5], got %v", regs)
+	}
+
+	// a profile without settings leaves them alone
+	profile := NewProfile(0, 1, LinkEnd, 0)
+	profile.Segments = []Segment{{Id: 0, Sp: 66.0, T: 60.0}}
+	if err := pxu.WriteProfile(profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := pxu.ReadProfile(0)
+	if err != nil {
+		t.Fatalf("failed to read profile: %v", err)
+	}
+	if !reflect.DeepEqual(got.Settings, want) {
+		t.Errorf("expected settings %v, got %v", want, got.Settings)
+	}
+
+	if err := pxu.WriteProfileSettings(&ProfileSettings{ErrorBandTime: MaxSegmentTime + 0.1}); err == nil {
+		t.Error("expected error for an error band time out of range")
+	}
+	if err := pxu.WriteProfileSettings(nil); err == nil {
+		t.Error("expected error for nil settings")
+	}
+}
+
+func TestPxu_ProfileRunControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		stuck    bool
+		action   func(*Pxu) error
+		expected RunStatus
+	}{
+		{name: "start", action: func(p *Pxu) error { return p.StartProfile(2, 1) }, expected: Run},
+		{name: "pause", action: (*Pxu).PauseProfile, expected: Pause},
+		{name: "resume", action: (*Pxu).ResumeProfile, expected: Run},
+		{name: "end", action: (*Pxu).EndProfile, expected: End},
+		{name: "controller ignores start", stuck: true, action: func(p *Pxu) error { return p.StartProfile(2, 1) }},
+		{name: "controller ignores pause", stuck: true, action: (*Pxu).PauseProfile},
+		{name: "controller ignores end", stuck: true, action: (*Pxu).EndProfile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			_ = mock.SetRegister(RegControllerStatus, RsStop)
+
+			var client Modbus = mock
+			if tt.stuck {
+				client = &stuckModbus{MockModbus: mock, stuck: RegControllerStatus}
+			}
+
+			pxu, err := NewPxu(1, client, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			err = tt.action(pxu)
+
+			if tt.stuck {
+				var rsErr *RunStatusError
+				if !errors.As(err, &rsErr) {
+					t.Fatalf("expected RunStatusError, got %v", err)
+				}
+				if rsErr.Got != Stop {
+					t.Errorf("expected reported status STOP, got %v", rsErr.Got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			rs, _ := mock.ReadRegister(RegControllerStatus)
+			if RunStatus(rs) != tt.expected {
+				t.Errorf("expected run status %v, got %v", tt.expected, RunStatus(rs))
+			}
+		})
+	}
+}
+
+// advancingModbus moves to the next segment when told to advance, reporting the given run status afterwards.
+type advancingModbus struct {
+	*MockModbus
+	status   RunStatus
+	segments uint16 // the segment count of the profile, advancing past the last one ends it
+	ignore   bool
+}
+
+func (m *advancingModbus) SetRegister(address, value uint16) error {
+	if address != RegControllerStatus || RunStatus(value) != AdvanceProfile {
+		return m.MockModbus.SetRegister(address, value)
+	}
+	if m.ignore {
+		return nil
+	}
+
+	ps, _ := m.MockModbus.ReadRegister(RegPS)
+	if ps+1 >= m.segments {
+		return m.MockModbus.SetRegister(RegControllerStatus, uint16(End))
+	}
+	_ = m.MockModbus.SetRegister(RegPS, ps+1)
+	return m.MockModbus.SetRegister(RegControllerStatus, uint16(m.status))
+}
+
+func TestPxu_AdvanceSegment(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   advancingModbus
+		from     RunStatus
+		expected uint16
+		err      error
+	}{
+		{name: "back to run", client: advancingModbus{status: Run, segments: 3}, from: Run, expected: 2},
+		{name: "keeps reporting advance", client: advancingModbus{status: AdvanceProfile, segments: 3}, from: Run, expected: 2},
+		{name: "while paused", client: advancingModbus{status: Run, segments: 3}, from: Pause, expected: 2},
+		{name: "past the last segment", client: advancingModbus{status: Run, segments: 2}, from: Run, expected: 1},
+		{name: "controller ignores advance", client: advancingModbus{ignore: true}, from: Run, expected: 1, err: ErrSegmentNotAdvanced},
+		{name: "no profile running", client: advancingModbus{status: Run, segments: 3}, from: Stop, expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			_ = mock.SetRegister(RegControllerStatus, uint16(tt.from))
+			_ = mock.SetRegister(RegPC, 4)
+			_ = mock.SetRegister(RegPS, 1)
+			client := tt.client
+			client.MockModbus = mock
+
+			pxu, err := NewPxu(1, &client, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			err = pxu.AdvanceSegment()
+			switch {
+			case tt.from == Stop:
+				var rsErr *RunStatusError
+				if !errors.As(err, &rsErr) || rsErr.Got != Stop {
+					t.Fatalf("expected RunStatusError, got %v", err)
+				}
+			case !errors.Is(err, tt.err) || (tt.err == nil && err != nil):
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+
+			if ps, _ := mock.ReadRegister(RegPS); ps != tt.expected {
+				t.Errorf("expected segment %d, got %d", tt.expected, ps)
+			}
+		})
+	}
+}
+
+func TestPxu_StartProfileSelection(t *testing.T) {
+	mock := NewMockModbus()
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	if err := pxu.StartProfile(5, 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pc, _ := mock.ReadRegister(RegPC)
+	ps, _ := mock.ReadRegister(RegPS)
+	if pc != 5 || ps != 3 {
+		t.Errorf("expected profile 5 segment 3, got profile %d segment %d", pc, ps)
+	}
+
+	if err := pxu.StartProfile(MaxProfiles, 0); err == nil {
+		t.Error("expected error for invalid profile")
+	}
+	if err := pxu.StartProfile(0, MaxSegments); err == nil {
+		t.Error("expected error for invalid segment")
+	}
+}
+
+func TestPxu_WritePid(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      *PidParameters
+		stuck       uint16
+		expectError bool
+	}{
+		{name: "successful write", params: &PidParameters{Group: 2, TP: 12.3, TI: 240, TD: 60}},
+		{name: "upper limits", params: &PidParameters{Group: PidGroupCount - 1, TP: MaxProportionalBand, TI: MaxIntegralTime, TD: MaxDerivativeTime}},
+		{name: "nil parameters", expectError: true},
+		{name: "group out of range", params: &PidParameters{Group: PidGroupCount}, expectError: true},
+		{name: "proportional band out of range", params: &PidParameters{TP: MaxProportionalBand + 0.1}, expectError: true},
+		{name: "integral time out of range", params: &PidParameters{TI: MaxIntegralTime + 1}, expectError: true},
+		{name: "derivative time out of range", params: &PidParameters{TD: MaxDerivativeTime + 1}, expectError: true},
+		{name: "group not switched", params: &PidParameters{Group: 1, TP: 5}, stuck: RegTGroup, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			var client Modbus = mock
+			if tt.stuck != 0 {
+				client = &stuckModbus{MockModbus: mock, stuck: tt.stuck}
+			}
+
+			pxu, err := NewPxu(1, client, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			err = pxu.WritePid(tt.params)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got, err := pxu.ReadPid()
+			if err != nil {
+				t.Fatalf("failed to read pid parameters: %v", err)
+			}
+			if *got != *tt.params {
+				t.Errorf("expected %v, got %v", tt.params, got)
+			}
+		})
+	}
+}
+
+func TestPxu_ReadScale(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(RegInputType, []uint16{InputProcess, 2})
+
+	registers := mock.GetStatsRegister()
+	registers[RegPV] = 0xFF9C // -1.00
+	registers[RegSP] = 1250   // 12.50
+	_ = mock.SetRegisters(0, registers)
+
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	scale, err := pxu.ReadScale()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if scale != (Scale{Decimals: 2}) {
+		t.Errorf("expected process scale with 2 decimals, got %v", scale)
+	}
+
+	stats, err := pxu.ReadStats()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+	if stats.Pv != -1.0 || stats.Sp != 12.5 {
+		t.Errorf("expected PV -1.00 and SP 12.50, got PV %f and SP %f", stats.Pv, stats.Sp)
+	}
+
+	_ = mock.SetRegister(RegDecimalPoint, 4)
+	if _, err := pxu.ReadScale(); err == nil {
+		t.Error("expected error for unsupported decimal point")
+	}
+}
+
+func TestPxu_UpdateSetpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       float64
+		expected    uint16
+		expectError bool
+	}{
+		{name: "positive", value: 35.0, expected: 350},
+		{name: "cold crash", value: -1.0, expected: 0xFFF6},
+		{name: "out of range", value: 5000, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockModbus()
+			pxu, err := NewPxu(1, mock, time.Second, 1)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			err = pxu.UpdateSetpoint(tt.value)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sp, _ := mock.ReadRegister(RegSP); sp != tt.expected {
+				t.Errorf("expected register 0x%04X, got 0x%04X", tt.expected, sp)
+			}
+		})
+	}
+}
+
+func TestPxu_GetSet(t *testing.T) {
+	mock := NewMockModbus()
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	if err := pxu.Set("sp", -2.5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.Set("link[2]", LinkStop); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sp, err := pxu.Get("sp"); err != nil || sp != -2.5 {
+		t.Errorf("expected sp -2.5, got %v (%v)", sp, err)
+	}
+	if link, _ := mock.ReadRegister(RegProfLink + 2); link != LinkStop {
+		t.Errorf("expected link register %d, got %d", LinkStop, link)
+	}
+
+	if err := pxu.Set("pv", 20); !errors.Is(err, ErrReadOnlyRegister) {
+		t.Errorf("expected ErrReadOnlyRegister, got %v", err)
+	}
+	if err := pxu.Set("tgroup", PidGroupCount); err == nil {
+		t.Error("expected range error")
+	}
+	if _, err := pxu.Get("bogus"); !errors.Is(err, ErrUnknownRegister) {
+		t.Errorf("expected ErrUnknownRegister, got %v", err)
+	}
+}
+
+// failingModbus fails every read with err, a timeout when nil, counting the attempts.
+type failingModbus struct {
+	*MockModbus
+	err   error
+	reads int
+}
+
+func (m *failingModbus) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	m.reads++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return nil, ErrTimeout
+}
+
+// shortModbus answers every read with one register less than requested.
+type shortModbus struct {
+	*MockModbus
+}
+
+func (m *shortModbus) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	regs, err := m.MockModbus.ReadRegisters(address, quantity)
+	return regs[:len(regs)-1], err
+}
+
+func TestPxu_Context(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancelDeadline()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		timeout  time.Duration
+		expected error
+		maxReads int
+	}{
+		{name: "cancelled before the first attempt", ctx: cancelled, timeout: time.Minute, expected: context.Canceled},
+		{name: "caller deadline stops the backoff", ctx: deadline, timeout: time.Minute, expected: context.DeadlineExceeded, maxReads: 3},
+		{name: "pxu timeout stops the backoff", ctx: context.Background(), timeout: 250 * time.Millisecond, expected: context.DeadlineExceeded, maxReads: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &failingModbus{MockModbus: NewMockModbus()}
+			pxu, err := NewPxu(1, client, tt.timeout, 30)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			started := time.Now()
+			_, err = pxu.ReadStatsContext(tt.ctx)
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if client.reads > tt.maxReads {
+				t.Errorf("expected at most %d reads, got %d", tt.maxReads, client.reads)
+			}
+			if elapsed := time.Since(started); elapsed > time.Second {
+				t.Errorf("expected the call to return promptly, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestPxu_RetryClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+		reads    int
+	}{
+		{name: "timeout is retried", err: fmt.Errorf("%w: no answer", ErrTimeout), expected: ErrTimeout, reads: 3},
+		{name: "framing error is retried", err: fmt.Errorf("%w: bad crc", ErrFraming), expected: ErrFraming, reads: 3},
+		{name: "device busy is retried", err: &ExceptionError{Code: ExServerDeviceBusy}, expected: ErrDeviceBusy, reads: 3},
+		{name: "illegal address fails at once", err: &ExceptionError{Code: ExIllegalDataAddress}, expected: ErrException, reads: 1},
+		{name: "unclassified error fails at once", err: ErrBusClosed, expected: ErrBusClosed, reads: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &failingModbus{MockModbus: NewMockModbus(), err: tt.err}
+			pxu, err := NewPxu(1, client, time.Second, 2)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			_, err = pxu.ReadPid()
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+			if client.reads != tt.reads {
+				t.Errorf("expected %d reads, got %d", tt.reads, client.reads)
+			}
+		})
+	}
+
+	t.Run("short response is retried", func(t *testing.T) {
+		pxu, err := NewPxu(1, &shortModbus{MockModbus: NewMockModbus()}, time.Second, 2)
+		if err != nil {
+			t.Fatalf("failed to create PXU: %v", err)
+		}
+		if _, err := pxu.ReadPid(); !errors.Is(err, ErrInvalidResponseLength) {
+			t.Errorf("expected %v, got %v", ErrInvalidResponseLength, err)
+		}
+	})
+}
+
+// flakyModbus fails the first writes with a timeout before passing them on.
+type flakyModbus struct {
+	*MockModbus
+	failures int
+	writes   int
+}
+
+func (m *flakyModbus) SetRegister(address, value uint16) error {
+	m.writes++
+	if m.writes <= m.failures {
+		return ErrTimeout
+	}
+	return m.MockModbus.SetRegister(address, value)
+}
+
+func TestPxu_WriteRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		write       func(*Pxu) error
+		writes      int
+		expectError bool
+	}{
+		{name: "setpoint is retried", write: func(p *Pxu) error { return p.UpdateSetpoint(50) }, writes: 2},
+		{name: "run status is retried", write: func(p *Pxu) error { return p.UpdateControllerStatus(uint16(Run)) }, writes: 2},
+		{name: "advance is sent once", write: func(p *Pxu) error { return p.UpdateControllerStatus(RsAdvance) }, writes: 1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &flakyModbus{MockModbus: NewMockModbus(), failures: 1}
+			pxu, err := NewPxu(1, client, time.Second, 2)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+
+			err = tt.write(pxu)
+
+			if tt.expectError != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+			if client.writes != tt.writes {
+				t.Errorf("expected %d writes, got %d", tt.writes, client.writes)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Priority orders the transactions waiting for a unit.  Writes default to PriorityHigh and reads to PriorityNormal, so
+// an operator changing the setpoint does not wait behind a backlog of polls.
+type Priority uint8
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	priorityCount
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", p)
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context which makes the transactions of an operation queue at the given priority, e.g.
+// PriorityLow for background polling.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFrom returns the priority stored in ctx, or def when there is none.
+func priorityFrom(ctx context.Context, def Priority) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok && priority < priorityCount {
+		return priority
+	}
+	return def
+}
+
+// QueueStats describes the transactions which went through the request queue of a Pxu.
+type QueueStats struct {
+	Depth     int           // transactions waiting right now
+	MaxDepth  int           // most transactions ever waiting at once
+	Requests  uint64        // transactions started
+	TotalWait time.Duration // time all started transactions spent waiting
+	MaxWait   time.Duration // longest time a transaction waited
+}
+
+// AverageWait returns the mean time a transaction waited before it was sent.
+func (s QueueStats) AverageWait() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Requests)
+}
+
+func (s QueueStats) String() string {
+	return fmt.Sprintf("Depth: %d, MaxDepth: %d, Requests: %d, AverageWait: %v, MaxWait: %v",
+		s.Depth, s.MaxDepth, s.Requests, s.AverageWait(), s.MaxWait)
+}
+
+// requestQueue runs one transaction at a time.  Waiting transactions are started highest priority first and in
+// arrival order within a priority.
+type requestQueue struct {
+	mu      sync.Mutex
+	busy    bool
+	waiting [priorityCount][]chan struct{}
+	stats   QueueStats
+}
+
+// do waits for the turn of the transaction and runs it.  The wait ends early when ctx is done.
+func (q *requestQueue) do(ctx context.Context, priority Priority, transaction func() error) error {
+	if err := q.acquire(ctx, priority); err != nil {
+		return err
+	}
+	defer q.release()
+
+	return transaction()
+}
+
+func (q *requestQueue) acquire(ctx context.Context, priority Priority) error {
+	enqueued := time.Now()
+
+	q.mu.Lock()
+	if !q.busy {
+		q.busy = true
+		q.started(0)
+		q.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{}, 1)
+	q.waiting[priority] = append(q.waiting[priority], ready)
+	q.stats.Depth++
+	q.stats.MaxDepth = max(q.stats.MaxDepth, q.stats.Depth)
+	q.mu.Unlock()
+
+	select {
+	case <-ready:
+		q.mu.Lock()
+		q.started(time.Since(enqueued))
+		q.mu.Unlock()
+		return nil
+
+	case <-ctx.Done():
+		q.mu.Lock()
+		if i := slices.Index(q.waiting[priority], ready); i >= 0 {
+			q.waiting[priority] = slices.Delete(q.waiting[priority], i, i+1)
+			q.stats.Depth--
+			q.mu.Unlock()
+			return ctx.Err()
+		}
+		q.mu.Unlock()
+
+		// the turn was handed over just now, pass it on
+		q.release()
+		return ctx.Err()
+	}
+}
+
+// release hands the queue to the next waiting transaction, or marks it idle.
+func (q *requestQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for priority := int(PriorityHigh); priority >= int(PriorityLow); priority-- {
+		queue := q.waiting[priority]
+		if len(queue) == 0 {
+			continue
+		}
+
+		ready := queue[0]
+		q.waiting[priority] = queue[1:]
+		q.stats.Depth--
+		ready <- struct{}{}
+		return
+	}
+
+	q.busy = false
+}
+
+// started records a transaction which waited for the given time.  q.mu must be held.
+func (q *requestQueue) started(wait time.Duration) {
+	q.stats.Requests++
+	q.stats.TotalWait += wait
+	q.stats.MaxWait = max(q.stats.MaxWait, wait)
+}
+
+func (q *requestQueue) snapshot() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
@@ -0,0 +1,172 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestQueue_Priority(t *testing.T) {
+	var q requestQueue
+
+	// waitDepth polls the queue until n transactions are waiting
+	waitDepth := func(n int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for q.snapshot().Depth != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %d queued transactions", n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	enqueue := func(priority Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = q.do(context.Background(), priority, func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, priority)
+				return nil
+			})
+		}()
+	}
+
+	// a poll holds the queue while the others line up
+	hold := make(chan struct{})
+	go func() {
+		_ = q.do(context.Background(), PriorityLow, func() error {
+			<-hold
+			return nil
+		})
+	}()
+	deadline := time.Now().Add(time.Second)
+	for q.snapshot().Requests != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the queue to be taken")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	queued := []Priority{PriorityLow, PriorityNormal, PriorityLow, PriorityHigh, PriorityNormal, PriorityHigh}
+	for i, priority := range queued {
+		enqueue(priority)
+		waitDepth(i + 1)
+	}
+
+	close(hold)
+	wg.Wait()
+
+	expected := []Priority{PriorityHigh, PriorityHigh, PriorityNormal, PriorityNormal, PriorityLow, PriorityLow}
+	if fmt.Sprint(order) != fmt.Sprint(expected) {
+		t.Errorf("expected transactions in order %v, got %v", expected, order)
+	}
+
+	stats := q.snapshot()
+	if stats.Depth != 0 || stats.MaxDepth != len(queued) || stats.Requests != uint64(len(queued)+1) {
+		t.Errorf("unexpected queue stats: %v", stats)
+	}
+	if stats.MaxWait <= 0 || stats.AverageWait() > stats.MaxWait {
+		t.Errorf("unexpected wait times: %v", stats)
+	}
+}
+
+func TestRequestQueue_Cancel(t *testing.T) {
+	var q requestQueue
+
+	hold := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_ = q.do(context.Background(), PriorityNormal, func() error {
+			close(started)
+			<-hold
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	ran := false
+	err := q.do(ctx, PriorityHigh, func() error {
+		ran = true
+		return nil
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) || ran {
+		t.Errorf("expected the waiting transaction to be dropped, got %v (ran: %v)", err, ran)
+	}
+	if depth := q.snapshot().Depth; depth != 0 {
+		t.Errorf("expected empty queue, got depth %d", depth)
+	}
+
+	close(hold)
+	if err := q.do(context.Background(), PriorityLow, func() error { return nil }); err != nil {
+		t.Errorf("expected the queue to be usable after a cancellation, got %v", err)
+	}
+}
+
+func TestPriorityFrom(t *testing.T) {
+	ctx := context.Background()
+
+	if got := priorityFrom(ctx, PriorityHigh); got != PriorityHigh {
+		t.Errorf("expected default %v, got %v", PriorityHigh, got)
+	}
+	if got := priorityFrom(WithPriority(ctx, PriorityLow), PriorityHigh); got != PriorityLow {
+		t.Errorf("expected %v, got %v", PriorityLow, got)
+	}
+}
+
+func TestPxu_Concurrent(t *testing.T) {
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			ctx := WithPriority(context.Background(), PriorityLow)
+			for j := 0; j < 20; j++ {
+				if _, err := pxu.ReadStatsContext(ctx); err != nil {
+					t.Errorf("failed to read stats: %v", err)
+				}
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := pxu.UpdateSetpoint(float64(i*10 + j)); err != nil {
+					t.Errorf("failed to update sp: %v", err)
+				}
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			profile := NewProfile(uint16(i), 2, LinkEnd, 0)
+			profile.Segments = []Segment{{Id: 0, Sp: float64(i), T: 1}, {Id: 1, Sp: float64(i) + 1, T: 2}}
+			if err := pxu.WriteProfile(profile); err != nil {
+				t.Errorf("failed to write profile %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stats := pxu.QueueStats(); stats.Depth != 0 || stats.Requests == 0 {
+		t.Errorf("unexpected queue stats: %v", stats)
+	}
+}
@@ -0,0 +1,363 @@
+package device
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+var ErrReplayMismatch = errors.New("transaction not in the recording")
+
+// MarshalText encodes the op by name, so recordings stay readable.
+func (o Op) MarshalText() ([]byte, error) {
+	if o > OpWrite {
+		return nil, fmt.Errorf("invalid op %d", o)
+	}
+	return []byte(o.String()), nil
+}
+
+func (o *Op) UnmarshalText(text []byte) error {
+	for _, op := range []Op{OpSetUnitId, OpRead, OpWrite} {
+		if string(text) == op.String() {
+			*o = op
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid op %q", text)
+}
+
+// Transaction is a Modbus transaction as it went over the wire, one JSON object per line in a recording.
+type Transaction struct {
+	Time      time.Time     `json:"time"`
+	Unit      UnitId        `json:"unit"`
+	Op        Op            `json:"op"`
+	Address   uint16        `json:"addr,omitempty"`
+	Quantity  uint16        `json:"qty,omitempty"`
+	Values    []uint16      `json:"values,omitempty"` // written, or read when the read succeeded
+	Error     string        `json:"error,omitempty"`
+	Class     string        `json:"class,omitempty"`     // the failure class of the error, e.g. "timeout"
+	Exception ExceptionCode `json:"exception,omitempty"` // the code of an exception response
+}
+
+func (t Transaction) String() string {
+	if t.Op == OpSetUnitId {
+		return fmt.Sprintf("%s %d", t.Op, t.Unit)
+	}
+	return fmt.Sprintf("unit %d %s addr=%d qty=%d", t.Unit, t.Op, t.Address, t.Quantity)
+}
+
+// Err rebuilds the error of the transaction.  It matches the failure class the recorded error did, so a replay takes
+// the same retry decisions as the original run.
+func (t Transaction) Err() error {
+	switch {
+	case t.Error == "":
+		return nil
+	case t.Exception != 0:
+		return &ExceptionError{Code: t.Exception}
+	}
+
+	for _, class := range failureClasses {
+		if t.Class == class.Error() {
+			return &replayedError{msg: t.Error, class: class}
+		}
+	}
+	return errors.New(t.Error)
+}
+
+// failureClasses are the errors a recording keeps track of, besides exceptions.
+var failureClasses = []error{
+	ErrTimeout, ErrFraming, ErrDeviceBusy, ErrInvalidResponseLength, ErrDisconnected, ErrCircuitOpen,
+}
+
+// replayedError is a recorded error, matching the failure class it had.
+type replayedError struct {
+	msg   string
+	class error
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.class
+}
+
+// Recorder writes every transaction passing through its middleware to a recording.  It must sit below the Bus, which
+// selects the unit before talking to it, so the recorder knows the unit each transaction was for.
+type Recorder struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	unit UnitId
+	err  error
+}
+
+// NewRecorder creates a recorder writing JSON lines to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Middleware returns the middleware recording into the recorder.
+func (r *Recorder) Middleware() Middleware {
+	return Intercept(func(call *Call, next func() error) error {
+		err := next()
+		r.record(call, err)
+		return err
+	})
+}
+
+func (r *Recorder) record(call *Call, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := Transaction{
+		Time:     time.Now(),
+		Unit:     r.unit,
+		Op:       call.Op,
+		Address:  call.Address,
+		Quantity: call.Quantity,
+		Values:   slices.Clone(call.Values),
+	}
+	if call.Op == OpSetUnitId {
+		t.Unit = call.Unit
+		if err == nil {
+			r.unit = call.Unit
+		}
+	}
+
+	if err != nil {
+		t.Error = err.Error()
+		var exception *ExceptionError
+		if errors.As(err, &exception) {
+			t.Exception = exception.Code
+		}
+		for _, class := range failureClasses {
+			if errors.Is(err, class) {
+				t.Class = class.Error()
+				break
+			}
+		}
+	}
+
+	if encErr := r.enc.Encode(t); encErr != nil && r.err == nil {
+		r.err = encErr
+	}
+}
+
+// Err returns the first error writing the recording, the transactions themselves are not affected by it.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// LoadRecording reads the transactions written by a Recorder.
+func LoadRecording(r io.Reader) ([]Transaction, error) {
+	var transactions []Transaction
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var t Transaction
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			return nil, fmt.Errorf("invalid transaction on line %d: %w", line, err)
+		}
+		transactions = append(transactions, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading recording: %w", err)
+	}
+	return transactions, nil
+}
+
+// ReplayMode selects how a Replay matches requests to the recording.
+type ReplayMode uint8
+
+const (
+	// ReplayInOrder expects the requests in the order they were recorded, and fails the first one which differs.
+	ReplayInOrder ReplayMode = iota
+	// ReplayByAddress answers a read with the next one recorded for the unit, address and quantity, repeating the
+	// last one when they run out.  Writes are accepted, failing as recorded when there is a matching one.
+	ReplayByAddress
+)
+
+func (m ReplayMode) String() string {
+	switch m {
+	case ReplayInOrder:
+		return "IN ORDER"
+	case ReplayByAddress:
+		return "BY ADDRESS"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", m)
+	}
+}
+
+// Replay is a Modbus client serving the transactions of a recording, so an incident can be reproduced without the
+// device.  Requests which do not fit the recording fail with ErrReplayMismatch.
+type Replay struct {
+	mode         ReplayMode
+	transactions []Transaction
+
+	mu     sync.Mutex
+	unit   UnitId
+	next   int                        // the next transaction, in order
+	queues map[replayKey]*replayQueue // the transactions of each request, by address
+}
+
+type replayKey struct {
+	unit     UnitId
+	op       Op
+	address  uint16
+	quantity uint16
+}
+
+type replayQueue struct {
+	transactions []*Transaction
+	next         int
+}
+
+// NewReplay creates a client replaying the transactions.
+func NewReplay(transactions []Transaction, mode ReplayMode) (*Replay, error) {
+	if mode > ReplayByAddress {
+		return nil, fmt.Errorf("invalid replay mode %d", mode)
+	}
+
+	r := &Replay{mode: mode, transactions: transactions, queues: make(map[replayKey]*replayQueue)}
+	for i := range r.transactions {
+		t := &r.transactions[i]
+		if t.Op == OpSetUnitId {
+			continue
+		}
+		key := replayKey{unit: t.Unit, op: t.Op, address: t.Address, quantity: t.Quantity}
+		q, ok := r.queues[key]
+		if !ok {
+			q = &replayQueue{}
+			r.queues[key] = q
+		}
+		q.transactions = append(q.transactions, t)
+	}
+	return r, nil
+}
+
+// Remaining returns the number of transactions not replayed yet.  By address, reads repeated from the last one and
+// writes without a recording do not count.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ReplayInOrder {
+		return len(r.transactions) - r.next
+	}
+	remaining := 0
+	for _, q := range r.queues {
+		remaining += len(q.transactions) - q.next
+	}
+	return remaining
+}
+
+// serve answers the call from the recording.
+func (r *Replay) serve(call *Call) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.mode == ReplayInOrder {
+		return r.serveInOrder(call)
+	}
+	return r.serveByAddress(call)
+}
+
+func (r *Replay) serveInOrder(call *Call) error {
+	if r.next >= len(r.transactions) {
+		return fmt.Errorf("%w: %s after the end of the recording", ErrReplayMismatch, call)
+	}
+
+	t := r.transactions[r.next]
+	unit := r.unit
+	if call.Op == OpSetUnitId {
+		unit = call.Unit
+	}
+	if t.Op != call.Op || t.Unit != unit || t.Address != call.Address || t.Quantity != call.Quantity ||
+		(call.Op == OpWrite && !slices.Equal(t.Values, call.Values)) {
+		return fmt.Errorf("%w: got %s, expected transaction %d: %s", ErrReplayMismatch, call, r.next+1, t)
+	}
+	r.next++
+
+	return r.answer(call, &t)
+}
+
+func (r *Replay) serveByAddress(call *Call) error {
+	if call.Op == OpSetUnitId {
+		r.unit = call.Unit
+		return nil
+	}
+
+	q, ok := r.queues[replayKey{unit: r.unit, op: call.Op, address: call.Address, quantity: call.Quantity}]
+	switch {
+	case ok && q.next < len(q.transactions):
+		q.next++
+		return r.answer(call, q.transactions[q.next-1])
+	case call.Op == OpWrite:
+		return nil
+	case ok:
+		return r.answer(call, q.transactions[len(q.transactions)-1])
+	default:
+		return fmt.Errorf("%w: unit %d %s", ErrReplayMismatch, r.unit, call)
+	}
+}
+
+// answer completes the call as the transaction did.
+func (r *Replay) answer(call *Call, t *Transaction) error {
+	if err := t.Err(); err != nil {
+		return err
+	}
+	switch call.Op {
+	case OpSetUnitId:
+		r.unit = call.Unit
+	case OpRead:
+		call.Values = slices.Clone(t.Values)
+	}
+	return nil
+}
+
+func (r *Replay) SetUnitId(id UnitId) error {
+	return r.serve(&Call{Op: OpSetUnitId, Unit: id})
+}
+
+func (r *Replay) ReadRegister(address uint16) (uint16, error) {
+	call := &Call{Op: OpRead, Address: address, Quantity: 1}
+	if err := r.serve(call); err != nil {
+		return ErrVal, err
+	}
+	if len(call.Values) != 1 {
+		return ErrVal, fmt.Errorf("%w: expected 1 register, got %d", ErrInvalidResponseLength, len(call.Values))
+	}
+	return call.Values[0], nil
+}
+
+func (r *Replay) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	call := &Call{Op: OpRead, Address: address, Quantity: quantity}
+	if err := r.serve(call); err != nil {
+		return nil, err
+	}
+	return call.Values, nil
+}
+
+func (r *Replay) SetRegister(address uint16, value uint16) error {
+	return r.serve(&Call{Op: OpWrite, Address: address, Quantity: 1, Values: []uint16{value}})
+}
+
+func (r *Replay) SetRegisters(startAddr uint16, values []uint16) error {
+	return r.serve(&Call{Op: OpWrite, Address: startAddr, Quantity: uint16(len(values)), Values: values})
+}
+
+func (r *Replay) Close() error {
+	return nil
+}
@@ -0,0 +1,231 @@
+package device
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// record runs fn against a mock holding the stats registers, and returns the recording.
+func record(t *testing.T, fn func(pxu *Pxu)) []Transaction {
+	t.Helper()
+
+	mock := NewMockModbus()
+	_ = mock.SetRegisters(0, mock.GetStatsRegister())
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	pxu, err := NewPxu(5, Chain(mock, recorder.Middleware()), time.Second, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fn(pxu)
+
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	transactions, err := LoadRecording(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return transactions
+}
+
+func TestRecorder(t *testing.T) {
+	transactions := record(t, func(pxu *Pxu) {
+		if _, err := pxu.ReadStats(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := pxu.UpdateSetpoint(65.5); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	if len(transactions) != 3 {
+		t.Fatalf("expected 3 transactions, got %v", transactions)
+	}
+
+	expected := []string{"set unit id 5", fmt.Sprintf("unit 5 read addr=0 qty=%d", StatsRegCount), "unit 5 write addr=1 qty=1"}
+	for i, tr := range transactions {
+		if tr.String() != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], tr)
+		}
+		if tr.Time.IsZero() || tr.Err() != nil {
+			t.Errorf("expected a timestamp and no error, got %+v", tr)
+		}
+	}
+	if !slices.Equal(transactions[2].Values, []uint16{655}) {
+		t.Errorf("expected the setpoint written, got %v", transactions[2].Values)
+	}
+	if len(transactions[1].Values) != StatsRegCount || transactions[1].Values[RegPV] != 255 {
+		t.Errorf("expected the stats registers read, got %v", transactions[1].Values)
+	}
+}
+
+func TestRecorder_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected []error
+	}{
+		{"timeout", ErrTimeout, []error{ErrTimeout}},
+		{"disconnected", ErrDisconnected, []error{ErrDisconnected}},
+		{"exception", &ExceptionError{Code: ExServerDeviceBusy}, []error{ErrException, ErrDeviceBusy}},
+		{"unclassified", errors.New("port closed"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			recorder := NewRecorder(&buf)
+			client := Chain(&failingModbus{MockModbus: NewMockModbus(), err: tt.err}, recorder.Middleware())
+			if _, err := client.ReadRegisters(RegPV, 2); err == nil {
+				t.Fatal("expected error but got none")
+			}
+
+			transactions, err := LoadRecording(&buf)
+			if err != nil || len(transactions) != 1 {
+				t.Fatalf("expected 1 transaction, got %v (%v)", transactions, err)
+			}
+
+			replayed := transactions[0].Err()
+			if replayed == nil || replayed.Error() != tt.err.Error() {
+				t.Fatalf("expected %q, got %v", tt.err, replayed)
+			}
+			for _, class := range tt.expected {
+				if !errors.Is(replayed, class) {
+					t.Errorf("expected %v to match %v", replayed, class)
+				}
+			}
+			if IsTransient(replayed) != IsTransient(tt.err) {
+				t.Errorf("expected transient %v, got %v", IsTransient(tt.err), IsTransient(replayed))
+			}
+		})
+	}
+}
+
+func TestLoadRecording_Invalid(t *testing.T) {
+	_, err := LoadRecording(strings.NewReader(`{"op":"read","addr":1,"qty":1}` + "\n" + `{"op":"erase"}`))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func TestReplay_InOrder(t *testing.T) {
+	session := func(pxu *Pxu) (*Stats, error) {
+		stats, err := pxu.ReadStats()
+		if err != nil {
+			return nil, err
+		}
+		return stats, pxu.UpdateSetpoint(65.5)
+	}
+
+	var recorded *Stats
+	transactions := record(t, func(pxu *Pxu) {
+		recorded, _ = session(pxu)
+	})
+
+	replay, err := NewReplay(transactions, ReplayInOrder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pxu, err := NewPxu(5, replay, time.Second, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats, err := session(pxu)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.String() != recorded.String() {
+		t.Errorf("expected %v, got %v", recorded, stats)
+	}
+	if replay.Remaining() != 0 {
+		t.Errorf("expected the recording replayed, %d transactions remaining", replay.Remaining())
+	}
+
+	if _, err := pxu.ReadStats(); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("expected %v after the end, got %v", ErrReplayMismatch, err)
+	}
+}
+
+func TestReplay_InOrderMismatch(t *testing.T) {
+	transactions := record(t, func(pxu *Pxu) {
+		_ = pxu.UpdateSetpoint(65.5)
+	})
+
+	replay, _ := NewReplay(transactions, ReplayInOrder)
+	if _, err := NewPxu(4, replay, time.Second, 1); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("expected %v for another unit, got %v", ErrReplayMismatch, err)
+	}
+
+	pxu, err := NewPxu(5, replay, time.Second, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.UpdateSetpoint(66); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("expected %v for another value, got %v", ErrReplayMismatch, err)
+	}
+	if replay.Remaining() != 1 {
+		t.Errorf("expected the mismatch not to consume the transaction, %d remaining", replay.Remaining())
+	}
+}
+
+func TestReplay_ByAddress(t *testing.T) {
+	transactions := []Transaction{
+		{Op: OpSetUnitId, Unit: 5},
+		{Unit: 5, Op: OpRead, Address: RegPV, Quantity: 1, Values: []uint16{200}},
+		{Unit: 5, Op: OpRead, Address: RegSP, Quantity: 1, Values: []uint16{650}},
+		{Unit: 5, Op: OpRead, Address: RegPV, Quantity: 1, Error: "timeout", Class: "timeout"},
+		{Unit: 5, Op: OpRead, Address: RegPV, Quantity: 1, Values: []uint16{210}},
+		{Unit: 5, Op: OpWrite, Address: RegSP, Quantity: 1, Values: []uint16{700}, Exception: ExIllegalDataValue, Error: "modbus exception 0x03: illegal data value"},
+	}
+
+	replay, err := NewReplay(transactions, ReplayByAddress)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = replay.SetUnitId(5)
+
+	tests := []struct {
+		name     string
+		address  uint16
+		expected uint16
+		err      error
+	}{
+		{"first pv", RegPV, 200, nil},
+		{"sp out of order", RegSP, 650, nil},
+		{"recorded timeout", RegPV, ErrVal, ErrTimeout},
+		{"last pv", RegPV, 210, nil},
+		{"pv repeated", RegPV, 210, nil},
+		{"not recorded", RegLED, ErrVal, ErrReplayMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val, err := replay.ReadRegister(tt.address)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if val != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, val)
+			}
+		})
+	}
+
+	if err := replay.SetRegister(RegSP, 700); !errors.Is(err, ErrException) {
+		t.Errorf("expected the recorded exception, got %v", err)
+	}
+	if err := replay.SetRegister(RegSP, 700); err != nil {
+		t.Errorf("expected writes beyond the recording to be accepted, got %v", err)
+	}
+
+	_ = replay.SetUnitId(6)
+	if _, err := replay.ReadRegister(RegPV); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("expected %v for another unit, got %v", ErrReplayMismatch, err)
+	}
+}
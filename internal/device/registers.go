@@ -0,0 +1,260 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownRegister  = errors.New("unknown register")
+	ErrReadOnlyRegister = errors.New("register is read only")
+)
+
+// DataType describes how the 16 bits of a register are interpreted.
+type DataType uint8
+
+const (
+	Uint16 DataType = iota
+	Int16
+	Bitmask
+)
+
+func (t DataType) String() string {
+	switch t {
+	case Uint16:
+		return "uint16"
+	case Int16:
+		return "int16"
+	case Bitmask:
+		return "bitmask"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", t)
+	}
+}
+
+// Scaling describes where the decimal point of a register value is.
+type Scaling uint8
+
+const (
+	ScaleNone       Scaling = iota // raw value
+	ScaleTenths                    // one fixed decimal
+	ScaleHundredths                // two fixed decimals
+	ScaleProcess                   // decimal point configured on the device, see Scale
+)
+
+// Access tells whether a register may be written.
+type Access uint8
+
+const (
+	ReadOnly Access = iota
+	ReadWrite
+)
+
+func (a Access) String() string {
+	if a == ReadWrite {
+		return "RW"
+	}
+	return "RO"
+}
+
+// Register describes a device parameter.  Registers with a Count above one are arrays of Count values spaced Stride
+// registers apart, addressed by name[index].
+type Register struct {
+	Name        string
+	Address     uint16
+	Type        DataType
+	Scaling     Scaling
+	Unit        string
+	Access      Access
+	Min         float64
+	Max         float64
+	Count       uint16
+	Stride      uint16
+	Feature     Feature // the register only exists on models with the feature
+	Volatile    bool    // reads back something else than was written, e.g. a command
+	Description string
+}
+
+// RegisterMap lists every register the library knows about.
+var RegisterMap = []Register{
+	{Name: "pv", Address: RegPV, Type: Int16, Scaling: ScaleProcess, Access: ReadOnly, Min: -1999, Max: 9999, Description: "Process Value"},
+	{Name: "sp", Address: RegSP, Type: Int16, Scaling: ScaleProcess, Access: ReadWrite, Min: -1999, Max: 9999, Description: "Active Setpoint"},
+	{Name: "op1", Address: RegOut1Power, Type: Int16, Scaling: ScaleTenths, Unit: "%", Access: ReadWrite, Min: MinOutputPower, Max: MaxOutputPower, Description: "Output Power 1, written in manual mode"},
+	{Name: "op2", Address: RegOut2Power, Type: Uint16, Scaling: ScaleTenths, Unit: "%", Access: ReadOnly, Max: MaxOutputPower, Feature: FeatureOut2, Description: "Output Power 2"},
+	{Name: "tp", Address: RegTP, Type: Uint16, Scaling: ScaleTenths, Unit: "%", Access: ReadWrite, Max: MaxProportionalBand, Description: "Proportional Band"},
+	{Name: "ti", Address: RegTI, Type: Uint16, Unit: "s", Access: ReadWrite, Max: MaxIntegralTime, Description: "Integral Time"},
+	{Name: "td", Address: RegTD, Type: Uint16, Unit: "s", Access: ReadWrite, Max: MaxDerivativeTime, Description: "Derivative Time"},
+	{Name: "tgroup", Address: RegTGroup, Type: Uint16, Access: ReadWrite, Max: PidGroupCount - 1, Description: "Parameter Set Selection"},
+	{Name: "at", Address: RegAutoTune, Type: Uint16, Access: ReadWrite, Max: AutoTuneOn, Volatile: true, Description: "Auto-Tune Start/Abort"},
+	{Name: "mode", Address: RegControlMode, Type: Uint16, Access: ReadWrite, Max: float64(ModeManual), Description: "Auto/Manual Mode"},
+	{Name: "rs", Address: RegControllerStatus, Type: Uint16, Access: ReadWrite, Max: RsAdvance, Volatile: true, Description: "Controller Status"},
+	{Name: "led", Address: RegLED, Type: Bitmask, Access: ReadOnly, Max: math.MaxUint16, Description: "LED Status"},
+	{Name: "alst", Address: RegAlarmStatus, Type: Bitmask, Access: ReadOnly, Max: math.MaxUint16, Feature: FeatureAlarms, Description: "Alarm State"},
+	{Name: "alrst", Address: RegAlarmReset, Type: Bitmask, Access: ReadWrite, Max: 1<<AlarmCount - 1, Volatile: true, Feature: FeatureAlarms, Description: "Alarm Reset"},
+	{Name: "pc", Address: RegPC, Type: Uint16, Access: ReadWrite, Max: MaxProfiles - 1, Feature: FeatureProfiles, Description: "Current Profile"},
+	{Name: "ps", Address: RegPS, Type: Uint16, Access: ReadWrite, Max: MaxSegments - 1, Feature: FeatureProfiles, Description: "Current Profile Segment"},
+	{Name: "psr", Address: RegPSR, Type: Uint16, Scaling: ScaleTenths, Unit: "min", Access: ReadOnly, Max: MaxSegmentTime, Feature: FeatureProfiles, Description: "Profile Segment Remaining Time"},
+	{Name: "firmware", Address: RegInfoStart + InfoRegCount - 1, Type: Uint16, Scaling: ScaleHundredths, Access: ReadOnly, Max: math.MaxUint16 / 100.0, Description: "Firmware Version"},
+	{Name: "input", Address: RegInputType, Type: Uint16, Access: ReadOnly, Max: math.MaxUint16, Description: "Input Type"},
+	{Name: "dp", Address: RegDecimalPoint, Type: Uint16, Access: ReadOnly, Max: MaxProcessDecimals, Description: "Decimal Point Position"},
+	{Name: "almode", Address: RegAlarmStart, Type: Uint16, Access: ReadWrite, Max: float64(AlarmBandOutside), Count: AlarmCount, Stride: AlarmRegStride, Feature: FeatureAlarms, Description: "Alarm Mode"},
+	{Name: "allatch", Address: RegAlarmStart + 1, Type: Uint16, Access: ReadWrite, Max: 1, Count: AlarmCount, Stride: AlarmRegStride, Feature: FeatureAlarms, Description: "Alarm Latch, 0 resets automatically"},
+	{Name: "alval", Address: RegAlarmStart + 2, Type: Int16, Scaling: ScaleProcess, Access: ReadWrite, Min: -1999, Max: 9999, Count: AlarmCount, Stride: AlarmRegStride, Feature: FeatureAlarms, Description: "Alarm Value"},
+	{Name: "alhys", Address: RegAlarmStart + 3, Type: Int16, Scaling: ScaleProcess, Access: ReadWrite, Max: 999.9, Count: AlarmCount, Stride: AlarmRegStride, Feature: FeatureAlarms, Description: "Alarm Hysteresis"},
+	{Name: "dev", Address: RegProfDEV, Type: Int16, Scaling: ScaleProcess, Access: ReadWrite, Max: 9999, Feature: FeatureProfiles, Description: "Guaranteed Soak Deviation Band"},
+	{Name: "ebt", Address: RegProfEBT, Type: Uint16, Scaling: ScaleTenths, Unit: "min", Access: ReadWrite, Max: MaxSegmentTime, Feature: FeatureProfiles, Description: "Error Band Time"},
+	{Name: "irr", Address: RegProfIRR, Type: Uint16, Scaling: ScaleTenths, Unit: "/min", Access: ReadWrite, Max: 999.9, Feature: FeatureProfiles, Description: "Initial Ramp Rate"},
+	{Name: "segsp", Address: RegProfSegmentStart, Type: Int16, Scaling: ScaleProcess, Access: ReadWrite, Min: MinSegmentSp, Max: MaxSegmentSp, Count: MaxProfiles * MaxSegments, Stride: 2, Feature: FeatureProfiles, Description: "Segment Setpoint, index profile*16+segment"},
+	{Name: "segtime", Address: RegProfSegmentStart + 1, Type: Uint16, Scaling: ScaleTenths, Unit: "min", Access: ReadWrite, Max: MaxSegmentTime, Count: MaxProfiles * MaxSegments, Stride: 2, Feature: FeatureProfiles, Description: "Segment Time, index profile*16+segment"},
+	{Name: "segcount", Address: RegNumSegments, Type: Uint16, Access: ReadWrite, Max: MaxSegments - 1, Count: MaxProfiles, Stride: 1, Feature: FeatureProfiles, Description: "Profile Segment Count minus one"},
+	{Name: "cycles", Address: RegProfCycleRepeat, Type: Uint16, Access: ReadWrite, Max: MaxCycleRepeat, Count: MaxProfiles, Stride: 1, Feature: FeatureProfiles, Description: "Profile Cycle Repeat"},
+	{Name: "link", Address: RegProfLink, Type: Uint16, Access: ReadWrite, Max: LinkStop, Count: MaxProfiles, Stride: 1, Feature: FeatureProfiles, Description: "Profile Link"},
+}
+
+// LookupRegister finds a register by name.  Array elements are addressed as name[index], the returned register then
+// describes that single element.
+func LookupRegister(name string) (Register, error) {
+	base, index, indexed, err := splitRegisterName(name)
+	if err != nil {
+		return Register{}, err
+	}
+
+	for _, r := range RegisterMap {
+		if r.Name != base {
+			continue
+		}
+
+		if r.Count <= 1 {
+			if indexed {
+				return Register{}, fmt.Errorf("%w: %s is not an array", ErrUnknownRegister, base)
+			}
+			return r, nil
+		}
+
+		if !indexed {
+			return Register{}, fmt.Errorf("%w: %s needs an index [0, %d]", ErrUnknownRegister, base, r.Count-1)
+		}
+		if index >= r.Count {
+			return Register{}, fmt.Errorf("%w: index %d of %s out of range [0, %d]", ErrUnknownRegister, index, base, r.Count-1)
+		}
+
+		r.Name = name
+		r.Address += index * r.Stride
+		r.Count = 1
+		return r, nil
+	}
+
+	return Register{}, fmt.Errorf("%w: %s", ErrUnknownRegister, name)
+}
+
+// registerAt finds the register at the address, an array element is described as by LookupRegister.
+func registerAt(addr uint16) (Register, bool) {
+	for _, r := range RegisterMap {
+		if r.Count <= 1 {
+			if r.Address == addr {
+				return r, true
+			}
+			continue
+		}
+
+		if addr < r.Address || (addr-r.Address)%r.Stride != 0 {
+			continue
+		}
+		if index := (addr - r.Address) / r.Stride; index < r.Count {
+			r.Name = fmt.Sprintf("%s[%d]", r.Name, index)
+			r.Address = addr
+			r.Count = 1
+			return r, true
+		}
+	}
+	return Register{}, false
+}
+
+func splitRegisterName(name string) (string, uint16, bool, error) {
+	base, rest, indexed := strings.Cut(strings.ToLower(strings.TrimSpace(name)), "[")
+	if !indexed {
+		return base, 0, false, nil
+	}
+
+	digits, ok := strings.CutSuffix(rest, "]")
+	index, err := strconv.ParseUint(digits, 10, 16)
+	if !ok || err != nil {
+		return "", 0, false, fmt.Errorf("%w: malformed name %q", ErrUnknownRegister, name)
+	}
+	return base, uint16(index), true, nil
+}
+
+// mustLookupRegister is for the names used by the library itself, which are guaranteed to be in the map.
+func mustLookupRegister(name string) Register {
+	r, err := LookupRegister(name)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// decodeRegister decodes the named register from a block of registers read starting at base.
+func decodeRegister(regs []uint16, base uint16, name string, scale Scale) float64 {
+	r := mustLookupRegister(name)
+	return r.Decode(regs[r.Address-base], scale)
+}
+
+func (r Register) factor(scale Scale) float64 {
+	switch r.Scaling {
+	case ScaleTenths:
+		return 10
+	case ScaleHundredths:
+		return 100
+	case ScaleProcess:
+		return scale.factor()
+	default:
+		return 1
+	}
+}
+
+// Decode converts the register value into engineering units.  scale is only used for ScaleProcess registers.
+func (r Register) Decode(reg uint16, scale Scale) float64 {
+	if r.Type == Int16 {
+		return float64(int16(reg)) / r.factor(scale)
+	}
+	return float64(reg) / r.factor(scale)
+}
+
+// Validate checks the value against the valid range of the register.
+func (r Register) Validate(value float64) error {
+	if math.IsNaN(value) || value < r.Min || value > r.Max {
+		return fmt.Errorf("%s: value %v out of range [%v, %v]", r.Name, value, r.Min, r.Max)
+	}
+	return nil
+}
+
+// Encode validates the value and converts it into a register value, rounding to the register's resolution.
+func (r Register) Encode(value float64, scale Scale) (uint16, error) {
+	if err := r.Validate(value); err != nil {
+		return 0, err
+	}
+
+	scaled := math.Round(value * r.factor(scale))
+	if r.Type == Int16 {
+		if scaled < math.MinInt16 || scaled > math.MaxInt16 {
+			return 0, fmt.Errorf("%s: value %v does not fit the register at %v", r.Name, value, scale)
+		}
+		return uint16(int16(scaled)), nil
+	}
+
+	if scaled < 0 || scaled > math.MaxUint16 {
+		return 0, fmt.Errorf("%s: value %v does not fit the register", r.Name, value)
+	}
+	return uint16(scaled), nil
+}
+
+func (r Register) String() string {
+	name := r.Name
+	if r.Count > 1 {
+		name = fmt.Sprintf("%s[%d]", r.Name, r.Count)
+	}
+	return fmt.Sprintf("%-12s %5d %-7s %s [%v, %v] %s %s", name, r.Address, r.Type, r.Access, r.Min, r.Max, r.Unit, r.Description)
+}
@@ -0,0 +1,114 @@
+package device
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegisterMap_Unique(t *testing.T) {
+	names := make(map[string]bool)
+	addresses := make(map[uint16]string)
+
+	for _, r := range RegisterMap {
+		if names[r.Name] {
+			t.Errorf("duplicate register name %s", r.Name)
+		}
+		names[r.Name] = true
+
+		count, stride := max(r.Count, 1), max(r.Stride, 1)
+		for i := uint16(0); i < count; i++ {
+			addr := r.Address + i*stride
+			if other, ok := addresses[addr]; ok {
+				t.Errorf("address %d used by %s and %s", addr, other, r.Name)
+			}
+			addresses[addr] = r.Name
+		}
+
+		if r.Min > r.Max {
+			t.Errorf("%s: min %v above max %v", r.Name, r.Min, r.Max)
+		}
+	}
+}
+
+func TestLookupRegister(t *testing.T) {
+	tests := []struct {
+		name        string
+		expected    uint16
+		expectError bool
+	}{
+		{name: "sp", expected: RegSP},
+		{name: " SP ", expected: RegSP},
+		{name: "link[3]", expected: RegProfLink + 3},
+		{name: "segsp[17]", expected: RegProfSegmentStart + 34},
+		{name: "segtime[17]", expected: RegProfSegmentStart + 35},
+		{name: "nope", expectError: true},
+		{name: "link", expectError: true},
+		{name: "link[16]", expectError: true},
+		{name: "link[x]", expectError: true},
+		{name: "link[3", expectError: true},
+		{name: "sp[0]", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := LookupRegister(tt.name)
+
+			if tt.expectError {
+				if !errors.Is(err, ErrUnknownRegister) {
+					t.Errorf("expected ErrUnknownRegister, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r.Address != tt.expected {
+				t.Errorf("expected address %d, got %d", tt.expected, r.Address)
+			}
+		})
+	}
+}
+
+func TestRegister_EncodeDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		scale       Scale
+		value       float64
+		reg         uint16
+		expectError bool
+	}{
+		{name: "sp", scale: DefaultScale, value: -1.0, reg: 0xFFF6},
+		{name: "sp", scale: Scale{Decimals: 0}, value: 350, reg: 350},
+		{name: "sp", scale: DefaultScale, value: 9999, expectError: true},
+		{name: "tp", scale: Scale{Decimals: 0}, value: 12.3, reg: 123},
+		{name: "tp", scale: DefaultScale, value: -0.1, expectError: true},
+		{name: "ti", scale: DefaultScale, value: 240, reg: 240},
+		{name: "ti", scale: DefaultScale, value: MaxIntegralTime + 1, expectError: true},
+		{name: "link[0]", scale: DefaultScale, value: LinkEnd, reg: LinkEnd},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustLookupRegister(tt.name)
+			reg, err := r.Encode(tt.value, tt.scale)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got 0x%04X", reg)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if reg != tt.reg {
+				t.Errorf("Encode(%v) = 0x%04X, expected 0x%04X", tt.value, reg, tt.reg)
+			}
+			if value := r.Decode(reg, tt.scale); value != tt.value {
+				t.Errorf("Decode(0x%04X) = %v, expected %v", reg, value, tt.value)
+			}
+		})
+	}
+}
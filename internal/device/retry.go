@@ -0,0 +1,65 @@
+package device
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy controls how often and how patiently a failed request is repeated.  Only transient failures are
+// retried, see IsTransient.  The delay before retry n is Base * Multiplier^(n-1), capped at Max and spread by
+// +/- Jitter of itself, so units sharing a line do not retry in lockstep.
+type RetryPolicy struct {
+	Retries    int           // retries after the first attempt, zero disables retrying
+	Base       time.Duration // delay before the first retry
+	Max        time.Duration // upper bound of a single delay
+	Multiplier float64       // growth of the delay per retry, at least 1
+	Jitter     float64       // random spread as a fraction of the delay, between 0 and 1
+	MaxElapsed time.Duration // no retry is started after this much time, zero leaves it to the context
+}
+
+// DefaultRetryPolicy returns the policy NewPxu starts with.
+func DefaultRetryPolicy(retries int) RetryPolicy {
+	return RetryPolicy{
+		Retries:    retries,
+		Base:       DefaultRetryBase,
+		Max:        DefaultRetryMax,
+		Multiplier: DefaultRetryMultiplier,
+		Jitter:     DefaultRetryJitter,
+	}
+}
+
+// Validate checks that the policy describes a sensible backoff.
+func (r RetryPolicy) Validate() error {
+	switch {
+	case r.Retries < 0:
+		return fmt.Errorf("retries must not be negative, got %d", r.Retries)
+	case r.Base <= 0:
+		return fmt.Errorf("base delay must be positive, got %v", r.Base)
+	case r.Max < r.Base:
+		return fmt.Errorf("max delay %v is below the base delay %v", r.Max, r.Base)
+	case r.Multiplier < 1:
+		return fmt.Errorf("multiplier must be at least 1, got %v", r.Multiplier)
+	case r.Jitter < 0 || r.Jitter > 1:
+		return fmt.Errorf("jitter must be between 0 and 1, got %v", r.Jitter)
+	case r.MaxElapsed < 0:
+		return fmt.Errorf("max elapsed must not be negative, got %v", r.MaxElapsed)
+	}
+	return nil
+}
+
+// Backoff returns the delay before the given retry, counting from one.
+func (r RetryPolicy) Backoff(retry int) time.Duration {
+	d := float64(r.Base) * math.Pow(r.Multiplier, float64(max(retry-1, 0)))
+	d = min(d, float64(r.Max))
+	if r.Jitter > 0 {
+		d += d * r.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+func (r RetryPolicy) String() string {
+	return fmt.Sprintf("Retries: %d, Base: %v, Max: %v, Multiplier: %v, Jitter: %v, MaxElapsed: %v",
+		r.Retries, r.Base, r.Max, r.Multiplier, r.Jitter, r.MaxElapsed)
+}
@@ -0,0 +1,70 @@
+package device
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{Retries: 10, Base: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{retry: 1, expected: 100 * time.Millisecond},
+		{retry: 2, expected: 200 * time.Millisecond},
+		{retry: 3, expected: 400 * time.Millisecond},
+		{retry: 4, expected: 800 * time.Millisecond},
+		{retry: 5, expected: time.Second},
+		{retry: 10, expected: time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.retry); got != tt.expected {
+			t.Errorf("retry %d: expected %v, got %v", tt.retry, tt.expected, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(3); got < 200*time.Millisecond || got > 600*time.Millisecond {
+			t.Fatalf("expected backoff within 400ms +/- 50%%, got %v", got)
+		}
+	}
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	valid := DefaultRetryPolicy(DefaultRetries)
+
+	tests := []struct {
+		name        string
+		modify      func(*RetryPolicy)
+		expectError bool
+	}{
+		{name: "default", modify: func(*RetryPolicy) {}},
+		{name: "no retries", modify: func(r *RetryPolicy) { r.Retries = 0 }},
+		{name: "negative retries", modify: func(r *RetryPolicy) { r.Retries = -1 }, expectError: true},
+		{name: "zero base", modify: func(r *RetryPolicy) { r.Base = 0 }, expectError: true},
+		{name: "max below base", modify: func(r *RetryPolicy) { r.Max = r.Base / 2 }, expectError: true},
+		{name: "shrinking", modify: func(r *RetryPolicy) { r.Multiplier = 0.5 }, expectError: true},
+		{name: "jitter above one", modify: func(r *RetryPolicy) { r.Jitter = 1.5 }, expectError: true},
+		{name: "negative max elapsed", modify: func(r *RetryPolicy) { r.MaxElapsed = -time.Second }, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := valid
+			tt.modify(&policy)
+
+			err := policy.Validate()
+
+			if tt.expectError && err == nil {
+				t.Error("expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
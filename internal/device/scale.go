@@ -0,0 +1,74 @@
+package device
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scale converts between register values and engineering units for registers which follow the decimal point
+// configured on the device (PV, SP and everything in process units).  These registers hold signed 16-bit integers,
+// so a cold-crash setpoint of -1.0 is 0xFFF6 on the wire.
+type Scale struct {
+	Decimals    uint16 // digits after the decimal point
+	Temperature bool   // temperature input (thermocouple/RTD), as opposed to a process signal
+}
+
+// DefaultScale matches the factory configuration: a temperature input with one decimal.
+var DefaultScale = Scale{Decimals: 1, Temperature: true}
+
+// NewScale derives the scaling from the input type and decimal point configuration registers.
+func NewScale(inputType, decimalPoint uint16) (Scale, error) {
+	scale := Scale{Decimals: decimalPoint, Temperature: inputType < InputProcess}
+
+	limit := uint16(MaxProcessDecimals)
+	if scale.Temperature {
+		limit = MaxTemperatureDecimals
+	}
+	if decimalPoint > limit {
+		return Scale{}, fmt.Errorf("decimal point %d not supported by input type %d", decimalPoint, inputType)
+	}
+
+	return scale, nil
+}
+
+func (s Scale) factor() float64 {
+	return math.Pow10(int(s.Decimals))
+}
+
+// Decode converts a register value into engineering units.
+func (s Scale) Decode(reg uint16) float64 {
+	return float64(int16(reg)) / s.factor()
+}
+
+// Encode converts a value in engineering units into a register value, rounding to the configured resolution.  Values
+// which do not fit into a signed 16-bit register are rejected.
+func (s Scale) Encode(value float64) (uint16, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("cannot encode %v", value)
+	}
+
+	scaled := math.Round(value * s.factor())
+	if scaled < math.MinInt16 || scaled > math.MaxInt16 {
+		return 0, fmt.Errorf("value %v out of range [%v, %v]", value, s.Min(), s.Max())
+	}
+
+	return uint16(int16(scaled)), nil
+}
+
+// Min returns the smallest value a register with this scale can hold.
+func (s Scale) Min() float64 {
+	return math.MinInt16 / s.factor()
+}
+
+// Max returns the largest value a register with this scale can hold.
+func (s Scale) Max() float64 {
+	return math.MaxInt16 / s.factor()
+}
+
+func (s Scale) String() string {
+	input := "process"
+	if s.Temperature {
+		input = "temperature"
+	}
+	return fmt.Sprintf("%s input, %d decimals", input, s.Decimals)
+}
@@ -0,0 +1,104 @@
+package device
+
+import (
+	"testing"
+)
+
+func TestNewScale(t *testing.T) {
+	tests := []struct {
+		name         string
+		inputType    uint16
+		decimalPoint uint16
+		expected     Scale
+		expectError  bool
+	}{
+		{name: "thermocouple without decimals", inputType: 0, decimalPoint: 0, expected: Scale{Decimals: 0, Temperature: true}},
+		{name: "rtd with one decimal", inputType: InputProcess - 1, decimalPoint: 1, expected: Scale{Decimals: 1, Temperature: true}},
+		{name: "temperature with two decimals", inputType: 1, decimalPoint: 2, expectError: true},
+		{name: "process with three decimals", inputType: InputProcess, decimalPoint: 3, expected: Scale{Decimals: 3}},
+		{name: "process with four decimals", inputType: InputProcess, decimalPoint: 4, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scale, err := NewScale(tt.inputType, tt.decimalPoint)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if scale != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, scale)
+			}
+		})
+	}
+}
+
+func TestScale_Decode(t *testing.T) {
+	tests := []struct {
+		scale    Scale
+		input    uint16
+		expected float64
+	}{
+		{DefaultScale, 0, 0.0},
+		{DefaultScale, 255, 25.5},
+		{DefaultScale, 0xFFF6, -1.0},
+		{DefaultScale, 0x8000, -3276.8},
+		{Scale{Decimals: 0}, 650, 650},
+		{Scale{Decimals: 2}, 1234, 12.34},
+		{Scale{Decimals: 3}, 0xFFFF, -0.001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scale.String(), func(t *testing.T) {
+			result := tt.scale.Decode(tt.input)
+			if result != tt.expected {
+				t.Errorf("Decode(0x%04X) = %f, expected %f", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScale_Encode(t *testing.T) {
+	tests := []struct {
+		scale       Scale
+		input       float64
+		expected    uint16
+		expectError bool
+	}{
+		{scale: DefaultScale, input: 25.5, expected: 255},
+		{scale: DefaultScale, input: -1.0, expected: 0xFFF6},
+		{scale: DefaultScale, input: 0.3, expected: 3},
+		{scale: DefaultScale, input: 3276.7, expected: 0x7FFF},
+		{scale: DefaultScale, input: 3276.8, expectError: true},
+		{scale: DefaultScale, input: -3276.9, expectError: true},
+		{scale: Scale{Decimals: 2}, input: 12.345, expected: 1235},
+		{scale: Scale{Decimals: 0}, input: 350, expected: 350},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scale.String(), func(t *testing.T) {
+			result, err := tt.scale.Encode(tt.input)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Encode(%f) expected error but got 0x%04X", tt.input, result)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Encode(%f) = 0x%04X, expected 0x%04X", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
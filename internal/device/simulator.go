@@ -0,0 +1,607 @@
+package device
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// PlantModel is a first-order thermal process.  Without power it settles at Ambient, with Out1 at 100% at Ambient +
+// HeatingPower and with Out2 at 100% at Ambient - CoolingPower.  TimeConstant is the time it takes to cover 63% of
+// the way there.
+type PlantModel struct {
+	Ambient      float64       // process units
+	HeatingPower float64       // rise at full Out1 in process units
+	CoolingPower float64       // drop at full Out2 in process units, 0 for a plant without cooling
+	TimeConstant time.Duration // how slowly the plant follows the power
+}
+
+// DefaultPlant is a kettle with a heating element and no cooling.  It reaches 100 °C in about 50 minutes at full power.
+var DefaultPlant = PlantModel{Ambient: 20, HeatingPower: 100, TimeConstant: 30 * time.Minute}
+
+// SimulatorOptions configures a Simulator.  The zero value simulates a DefaultPlant in real time.
+type SimulatorOptions struct {
+	Plant      PlantModel       // DefaultPlant when TimeConstant is zero
+	Model      string           // reported in the info block, DefaultSimulatorModel when empty
+	Firmware   float64          // reported in the info block, DefaultSimulatorFirmware when zero
+	Span       float64          // input range the proportional band is a percentage of, DefaultSimulatorSpan when zero
+	Hysteresis float64          // switching band of on/off control, DefaultSimulatorHysteresis when zero
+	Autotune   time.Duration    // simulated duration of a tune, DefaultSimulatorAutotune when zero
+	Speed      float64          // simulated time per real time, e.g. 60 runs an hour long profile in a minute; 1 when zero
+	Now        func() time.Time // the clock driving the simulation, time.Now when nil
+}
+
+// Simulator is a Modbus client impersonating PXU controllers, one per unit ID, each heating its own plant.  Unlike
+// MockModbus the registers follow the physics: PV moves with the output power, the control loop drives Out1 and Out2,
+// profiles run through their segments and alarms trip.
+//
+// A proportional band of 0 selects on/off control, as on the device.  Writing Run after selecting a profile or
+// segment starts the profile, otherwise the controller holds SP.  Writes to read-only registers and values out of
+// range are answered with exception responses.  The simulation catches up with the clock on every transaction.
+type Simulator struct {
+	opts SimulatorOptions
+
+	mu    sync.Mutex
+	last  time.Time
+	unit  UnitId
+	units map[UnitId]*simulatedUnit
+}
+
+// NewSimulator creates a simulator, filling in the defaults of opts.
+func NewSimulator(opts SimulatorOptions) (*Simulator, error) {
+	if opts.Plant.TimeConstant == 0 {
+		opts.Plant = DefaultPlant
+	}
+	if opts.Model == "" {
+		opts.Model = DefaultSimulatorModel
+	}
+	if opts.Firmware == 0 {
+		opts.Firmware = DefaultSimulatorFirmware
+	}
+	if opts.Span == 0 {
+		opts.Span = DefaultSimulatorSpan
+	}
+	if opts.Hysteresis == 0 {
+		opts.Hysteresis = DefaultSimulatorHysteresis
+	}
+	if opts.Autotune == 0 {
+		opts.Autotune = DefaultSimulatorAutotune
+	}
+	if opts.Speed == 0 {
+		opts.Speed = 1
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	switch {
+	case opts.Plant.TimeConstant < 0 || opts.Plant.HeatingPower < 0 || opts.Plant.CoolingPower < 0:
+		return nil, fmt.Errorf("%w: plant %+v cannot be negative", ErrInvalidConfiguration, opts.Plant)
+	case len(opts.Model) > 2*(InfoRegCount-1):
+		return nil, fmt.Errorf("%w: model %q longer than %d characters", ErrInvalidConfiguration, opts.Model, 2*(InfoRegCount-1))
+	case opts.Span < 0 || opts.Hysteresis < 0 || opts.Autotune < 0 || opts.Speed < 0:
+		return nil, fmt.Errorf("%w: span, hysteresis, autotune and speed cannot be negative", ErrInvalidConfiguration)
+	}
+
+	return &Simulator{opts: opts, last: opts.Now(), units: make(map[UnitId]*simulatedUnit)}, nil
+}
+
+// advance runs the simulation up to the clock.  The caller must hold the lock.
+func (s *Simulator) advance() {
+	now := s.opts.Now()
+	elapsed := time.Duration(float64(now.Sub(s.last)) * s.opts.Speed)
+	s.last = now
+
+	for elapsed > 0 {
+		dt := min(elapsed, SimulatorStep)
+		for _, u := range s.units {
+			u.step(dt)
+		}
+		elapsed -= dt
+	}
+}
+
+// current returns the selected unit, powering it up on first use.  The caller must hold the lock.
+func (s *Simulator) current() *simulatedUnit {
+	u, ok := s.units[s.unit]
+	if !ok {
+		u = newSimulatedUnit(s.opts)
+		s.units[s.unit] = u
+	}
+	return u
+}
+
+func (s *Simulator) SetUnitId(id UnitId) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	s.unit = id
+	s.current()
+	return nil
+}
+
+func (s *Simulator) ReadRegister(address uint16) (uint16, error) {
+	regs, err := s.ReadRegisters(address, 1)
+	if err != nil {
+		return ErrVal, err
+	}
+	return regs[0], nil
+}
+
+func (s *Simulator) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	if quantity == 0 || quantity > MaxReadRegisters {
+		return nil, &ExceptionError{Code: ExIllegalDataValue}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	u := s.current()
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = u.regs[address+uint16(i)]
+	}
+	return regs, nil
+}
+
+func (s *Simulator) SetRegister(address uint16, value uint16) error {
+	return s.SetRegisters(address, []uint16{value})
+}
+
+func (s *Simulator) SetRegisters(startAddr uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > MaxWriteRegisters {
+		return &ExceptionError{Code: ExIllegalDataValue}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	u := s.current()
+
+	// the device refuses the whole request when one of the registers does not take the value
+	for i, value := range values {
+		if code, ok := u.accepts(startAddr+uint16(i), value); !ok {
+			return &ExceptionError{Code: code}
+		}
+	}
+	for i, value := range values {
+		u.write(startAddr+uint16(i), value)
+	}
+	return nil
+}
+
+func (s *Simulator) Close() error {
+	return nil
+}
+
+// simulatedUnit is one controller and the plant it heats.
+type simulatedUnit struct {
+	opts SimulatorOptions
+	regs map[uint16]uint16
+	pid  [PidGroupCount][3]uint16 // TP, TI and TD of every parameter set
+
+	pv       float64
+	lastPv   float64
+	integral float64 // integral term of the PID output in percent
+	relay    int     // on/off control: 1 heating, -1 cooling, 0 off
+	autotune time.Duration
+	armed    bool // a profile or segment was selected, so Run starts the profile
+	profile  *profileRun
+	alarms   [AlarmCount]alarmState
+}
+
+// profileRun is the progress of the running profile.
+type profileRun struct {
+	id        uint16
+	segment   uint16
+	cycle     uint16        // repeats run so far
+	initial   bool          // ramping to the first setpoint at the initial ramp rate
+	from      float64       // setpoint at the start of the segment
+	elapsed   time.Duration // segment time run so far
+	outOfBand time.Duration // how long PV has been outside the guaranteed soak band
+}
+
+type alarmState struct {
+	active  bool
+	latched bool
+}
+
+func newSimulatedUnit(opts SimulatorOptions) *simulatedUnit {
+	u := &simulatedUnit{opts: opts, regs: make(map[uint16]uint16), pv: opts.Plant.Ambient, lastPv: opts.Plant.Ambient}
+
+	for i := 0; i < len(opts.Model); i++ {
+		u.regs[RegInfoStart+uint16(i/2)] |= uint16(opts.Model[i]) << (8 * (1 - i%2))
+	}
+	u.regs[RegInfoStart+InfoRegCount-1] = uint16(math.Round(opts.Firmware * 100))
+	u.regs[RegInputType] = 0
+	u.regs[RegDecimalPoint] = DefaultScale.Decimals
+
+	for id := range uint16(MaxProfiles) {
+		u.regs[RegProfLink+id] = LinkEnd
+	}
+
+	// every parameter set starts out tuned to the plant
+	tuned := u.tuned()
+	for group := range u.pid {
+		u.pid[group] = tuned
+	}
+	u.regs[RegTP], u.regs[RegTI], u.regs[RegTD] = tuned[0], tuned[1], tuned[2]
+
+	u.regs[RegControllerStatus] = uint16(Run)
+	u.setProcess(RegSP, opts.Plant.Ambient)
+	u.setProcess(RegPV, u.pv)
+	u.regs[RegLED] = LEDCelsius
+	return u
+}
+
+// tuned returns the PID parameters an internal model control rule gives for the plant, with a closed loop twice as
+// fast as the plant itself.
+func (u *simulatedUnit) tuned() [3]uint16 {
+	plant := u.opts.Plant
+	band := min(plant.HeatingPower/2/u.opts.Span*100, MaxProportionalBand)
+	integral := min(plant.TimeConstant.Seconds(), MaxIntegralTime)
+	return [3]uint16{uint16(math.Round(band * 10)), uint16(math.Round(integral)), 0}
+}
+
+func (u *simulatedUnit) process(addr uint16) float64 {
+	return DefaultScale.Decode(u.regs[addr])
+}
+
+func (u *simulatedUnit) setProcess(addr uint16, value float64) {
+	value = max(DefaultScale.Min(), min(value, DefaultScale.Max()))
+	u.regs[addr], _ = DefaultScale.Encode(value)
+}
+
+func (u *simulatedUnit) tenths(addr uint16) float64 {
+	return float64(u.regs[addr]) / 10
+}
+
+func (u *simulatedUnit) setTenths(addr uint16, value float64) {
+	u.regs[addr] = uint16(int16(math.Round(value * 10)))
+}
+
+func (u *simulatedUnit) status() RunStatus {
+	return RunStatus(u.regs[RegControllerStatus])
+}
+
+// accepts checks a write against the register map.  It returns the exception code and false when the device would
+// refuse it.
+func (u *simulatedUnit) accepts(addr, value uint16) (ExceptionCode, bool) {
+	r, ok := registerAt(addr)
+	if !ok {
+		return 0, true
+	}
+	if r.Access != ReadWrite {
+		return ExIllegalDataAddress, false
+	}
+	if err := r.Validate(r.Decode(value, DefaultScale)); err != nil {
+		return ExIllegalDataValue, false
+	}
+	return 0, true
+}
+
+// write stores a register and carries out what writing it does on the device.
+func (u *simulatedUnit) write(addr, value uint16) {
+	switch addr {
+	case RegTP, RegTI, RegTD:
+		u.regs[addr] = value
+		u.pid[u.regs[RegTGroup]][addr-RegTP] = value
+	case RegTGroup:
+		u.regs[addr] = value
+		u.regs[RegTP], u.regs[RegTI], u.regs[RegTD] = u.pid[value][0], u.pid[value][1], u.pid[value][2]
+	case RegAutoTune:
+		u.autotune = 0
+		if value == AutoTuneOn && u.status() != Stop && ControlMode(u.regs[RegControlMode]) == ModeAuto {
+			u.autotune = u.opts.Autotune
+			u.regs[addr] = AutoTuneOn
+		} else {
+			u.regs[addr] = AutoTuneOff
+		}
+	case RegControllerStatus:
+		u.changeStatus(RunStatus(value))
+	case RegPC, RegPS:
+		u.regs[addr] = value
+		u.armed = true
+	case RegAlarmReset:
+		for i := range u.alarms {
+			if value&(1<<i) != 0 {
+				u.alarms[i].latched = false
+			}
+		}
+		u.updateAlarmStatus()
+	default:
+		u.regs[addr] = value
+	}
+}
+
+// changeStatus switches the run status the way the device does.
+func (u *simulatedUnit) changeStatus(status RunStatus) {
+	switch status {
+	case Stop, End:
+		u.profile = nil
+		u.autotune = 0
+		u.regs[RegAutoTune] = AutoTuneOff
+	case Run:
+		if u.profile == nil && u.armed {
+			u.startProfile(u.regs[RegPC], u.regs[RegPS])
+		}
+	case Pause:
+		if u.profile == nil {
+			return
+		}
+	case AdvanceProfile:
+		if u.profile == nil {
+			return
+		}
+		if u.nextSegment(); u.profile == nil {
+			return // past the last segment, the profile ended
+		}
+		status = Run
+	}
+	u.armed = false
+	u.regs[RegControllerStatus] = uint16(status)
+}
+
+func (u *simulatedUnit) segmentSp(id, segment uint16) float64 {
+	return u.process(RegProfSegmentStart + id*ProfileRegStride + segment*2)
+}
+
+func (u *simulatedUnit) segmentTime(id, segment uint16) time.Duration {
+	return time.Duration(u.tenths(RegProfSegmentStart+id*ProfileRegStride+segment*2+1) * float64(time.Minute))
+}
+
+// startProfile runs the profile from the segment.  The setpoint ramps from PV at the initial ramp rate, or jumps to
+// the segment setpoint when the rate is 0.
+func (u *simulatedUnit) startProfile(id, segment uint16) {
+	segment = min(segment, u.regs[RegNumSegments+id])
+	u.profile = &profileRun{id: id, segment: segment, initial: true}
+	u.setProcess(RegSP, u.pv)
+	if u.tenths(RegProfIRR) == 0 {
+		u.setProcess(RegSP, u.segmentSp(id, segment))
+		u.profile.initial = false
+	}
+	u.profile.from = u.process(RegSP)
+	u.regs[RegPC], u.regs[RegPS] = id, segment
+	u.setTenths(RegPSR, u.segmentTime(id, segment).Minutes())
+}
+
+// nextSegment moves on to the next segment, repeating the profile or following its link after the last one.
+func (u *simulatedUnit) nextSegment() {
+	run := u.profile
+	run.segment++
+	if run.segment > u.regs[RegNumSegments+run.id] {
+		run.segment = 0
+		if run.cycle < u.regs[RegProfCycleRepeat+run.id] {
+			run.cycle++
+		} else if link := u.regs[RegProfLink+run.id]; link < MaxProfiles {
+			run.id, run.cycle = link, 0
+		} else {
+			// the setpoint stays where the profile left it
+			u.profile = nil
+			u.regs[RegPSR] = 0
+			if link == LinkStop {
+				u.regs[RegControllerStatus] = uint16(Stop)
+			} else {
+				u.regs[RegControllerStatus] = uint16(End)
+			}
+			return
+		}
+	}
+
+	run.initial = false
+	run.from = u.process(RegSP)
+	run.elapsed, run.outOfBand = 0, 0
+	u.regs[RegPC], u.regs[RegPS] = run.id, run.segment
+	u.setTenths(RegPSR, u.segmentTime(run.id, run.segment).Minutes())
+}
+
+// runProfile moves the setpoint along the segment.  With a guaranteed soak band the segment time stops while PV has
+// been outside the band for longer than the error band time.
+func (u *simulatedUnit) runProfile(dt time.Duration) {
+	run := u.profile
+	target := u.segmentSp(run.id, run.segment)
+	duration := u.segmentTime(run.id, run.segment)
+
+	if run.initial {
+		// the ramp position is kept apart from SP, which would round away steps below its resolution
+		sp := run.from
+		step := u.tenths(RegProfIRR) * dt.Minutes()
+		if math.Abs(target-sp) <= step {
+			sp, run.initial = target, false
+		} else {
+			sp += math.Copysign(step, target-sp)
+		}
+		run.from = sp
+		u.setProcess(RegSP, sp)
+		return
+	}
+
+	if dev := u.process(RegProfDEV); dev > 0 && math.Abs(u.pv-u.process(RegSP)) > dev {
+		run.outOfBand += dt
+	} else {
+		run.outOfBand = 0
+	}
+	errorBand := time.Duration(u.tenths(RegProfEBT) * float64(time.Minute))
+	if run.outOfBand <= errorBand {
+		run.elapsed += dt
+	}
+
+	if run.elapsed >= duration {
+		u.setProcess(RegSP, target)
+		u.nextSegment()
+		return
+	}
+	u.setProcess(RegSP, run.from+(target-run.from)*float64(run.elapsed)/float64(duration))
+	u.setTenths(RegPSR, (duration - run.elapsed).Minutes())
+}
+
+// step advances the unit by dt.
+func (u *simulatedUnit) step(dt time.Duration) {
+	if u.profile != nil && u.status() == Run {
+		u.runProfile(dt)
+	}
+
+	power := u.control(dt)
+
+	plant := u.opts.Plant
+	target := plant.Ambient + plant.HeatingPower*max(power, 0)/100 - plant.CoolingPower*max(-power, 0)/100
+	u.lastPv = u.pv
+	u.pv = target + (u.pv-target)*math.Exp(-dt.Seconds()/plant.TimeConstant.Seconds())
+	u.setProcess(RegPV, u.pv)
+
+	led := u.regs[RegLED] &^ (LEDOut1 | LEDOut2 | LEDAt)
+	if power > 0 {
+		led |= LEDOut1
+	}
+	if power < 0 {
+		led |= LEDOut2
+	}
+	if u.autotune > 0 {
+		led |= LEDAt
+	}
+	u.regs[RegLED] = led
+
+	u.evaluateAlarms()
+}
+
+// control returns the output power in percent, negative for Out2, and updates the output power registers.
+func (u *simulatedUnit) control(dt time.Duration) float64 {
+	if ControlMode(u.regs[RegControlMode]) == ModeManual {
+		if u.status() == Stop {
+			return 0
+		}
+		power := u.limit(float64(int16(u.regs[RegOut1Power])) / 10)
+		u.setTenths(RegOut2Power, max(-power, 0))
+		return power
+	}
+
+	var power float64
+	switch {
+	case u.status() == Stop:
+		u.integral, u.relay = 0, 0
+	case u.autotune > 0:
+		power = u.onOff()
+		u.autotune -= dt
+		if u.autotune <= 0 {
+			u.autotune = 0
+			u.regs[RegAutoTune] = AutoTuneOff
+			tuned := u.tuned()
+			u.regs[RegTP], u.regs[RegTI], u.regs[RegTD] = tuned[0], tuned[1], tuned[2]
+			u.pid[u.regs[RegTGroup]] = tuned
+		}
+	case u.regs[RegTP] == 0:
+		power = u.onOff()
+	default:
+		power = u.pidOutput(dt)
+	}
+
+	power = u.limit(power)
+	u.setTenths(RegOut1Power, power)
+	u.setTenths(RegOut2Power, max(-power, 0))
+	return power
+}
+
+// limit clamps the power to what the outputs can deliver, Out2 only drives a plant with cooling.
+func (u *simulatedUnit) limit(power float64) float64 {
+	low := 0.0
+	if u.opts.Plant.CoolingPower > 0 {
+		low = MinOutputPower
+	}
+	return max(low, min(power, MaxOutputPower))
+}
+
+// onOff switches the outputs fully on below SP - hysteresis and off again at SP, cooling likewise above SP.
+func (u *simulatedUnit) onOff() float64 {
+	e := u.process(RegSP) - u.pv
+	h := u.opts.Hysteresis
+
+	switch {
+	case e > h:
+		u.relay = 1
+	case e < -h && u.opts.Plant.CoolingPower > 0:
+		u.relay = -1
+	case u.relay == 1 && e <= 0, u.relay == -1 && e >= 0:
+		u.relay = 0
+	}
+	return float64(u.relay) * MaxOutputPower
+}
+
+// pidOutput computes the PID output.  The derivative acts on PV so setpoint changes do not kick the output, and the
+// integral term is held within the output range against windup.
+func (u *simulatedUnit) pidOutput(dt time.Duration) float64 {
+	band := u.tenths(RegTP) / 100 * u.opts.Span
+	gain := MaxOutputPower / band
+	e := u.process(RegSP) - u.pv
+
+	if ti := float64(u.regs[RegTI]); ti > 0 {
+		u.integral += gain * e * dt.Seconds() / ti
+		u.integral = u.limit(u.integral)
+	} else {
+		u.integral = 0
+	}
+	derivative := -gain * float64(u.regs[RegTD]) * (u.pv - u.lastPv) / dt.Seconds()
+
+	return gain*e + u.integral + derivative
+}
+
+// evaluateAlarms trips and clears the alarms, each clearing only once PV moved back by the hysteresis.
+func (u *simulatedUnit) evaluateAlarms() {
+	sp := u.process(RegSP)
+	for i := range u.alarms {
+		start := RegAlarmStart + uint16(i)*AlarmRegStride
+		mode := AlarmMode(u.regs[start])
+		latch := u.regs[start+1] != 0
+		value, hysteresis := u.process(start+2), u.process(start+3)
+
+		// every mode compares a value against the alarm value, tripping above it or below it
+		var x float64
+		high := true
+		switch mode {
+		case AlarmAbsoluteHigh:
+			x = u.pv
+		case AlarmAbsoluteLow:
+			x, high = u.pv, false
+		case AlarmDeviationHigh:
+			x = u.pv - sp
+		case AlarmDeviationLow:
+			x = sp - u.pv
+		case AlarmBandInside:
+			x, high = math.Abs(u.pv-sp), false
+		case AlarmBandOutside:
+			x = math.Abs(u.pv - sp)
+		default:
+			u.alarms[i] = alarmState{}
+			continue
+		}
+		if !high {
+			x, value = -x, -value
+		}
+
+		state := &u.alarms[i]
+		switch {
+		case x > value:
+			state.active = true
+		case state.active && x < value-hysteresis:
+			state.active = false
+			state.latched = latch
+		}
+	}
+	u.updateAlarmStatus()
+}
+
+func (u *simulatedUnit) updateAlarmStatus() {
+	var status uint16
+	for i, state := range u.alarms {
+		if state.active {
+			status |= 1 << i
+		}
+		if state.latched {
+			status |= 1 << (i + AlarmLatchedShift)
+		}
+	}
+	u.regs[RegAlarmStatus] = status
+}
@@ -0,0 +1,390 @@
+package device
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// simClock is the clock of a simulator under test.  It moves when told to, and by tick on every reading.
+type simClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	tick time.Duration
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.tick)
+	return c.now
+}
+
+func (c *simClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newSimulatedPxu returns a Pxu talking to a simulator of the plant, driven by the returned clock.
+func newSimulatedPxu(t *testing.T, plant PlantModel) (*Pxu, *simClock) {
+	t.Helper()
+
+	clock := &simClock{now: time.Date(2025, 6, 1, 8, 0, 0, 0, time.UTC)}
+	sim, err := NewSimulator(SimulatorOptions{Plant: plant, Now: clock.Now})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pxu, err := NewPxu(5, sim, time.Second, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return pxu, clock
+}
+
+func readStats(t *testing.T, pxu *Pxu) *Stats {
+	t.Helper()
+
+	stats, err := pxu.ReadStats()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return stats
+}
+
+func TestNewSimulator(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        SimulatorOptions
+		expectError bool
+	}{
+		{name: "defaults"},
+		{name: "heat and cool", opts: SimulatorOptions{Plant: PlantModel{Ambient: 10, HeatingPower: 50, CoolingPower: 30, TimeConstant: time.Minute}}},
+		{name: "negative power", opts: SimulatorOptions{Plant: PlantModel{HeatingPower: -1, TimeConstant: time.Minute}}, expectError: true},
+		{name: "model too long", opts: SimulatorOptions{Model: "PXU11220-SPECIAL"}, expectError: true},
+		{name: "negative speed", opts: SimulatorOptions{Speed: -1}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSimulator(tt.opts)
+			if tt.expectError != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestSimulator_Identity(t *testing.T) {
+	pxu, _ := newSimulatedPxu(t, DefaultPlant)
+
+	info, err := pxu.ReadInfo()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Model != DefaultSimulatorModel || info.Firmware != "1.10" {
+		t.Errorf("expected %s 1.10, got %v", DefaultSimulatorModel, info)
+	}
+
+	scale, err := pxu.ReadScale()
+	if err != nil || scale != DefaultScale {
+		t.Errorf("expected %+v, got %+v (%v)", DefaultScale, scale, err)
+	}
+
+	caps, err := pxu.DetectCapabilities()
+	if err != nil || !caps.Has(FeatureProfiles) {
+		t.Errorf("expected profiles to be supported, got %v (%v)", caps, err)
+	}
+
+	stats := readStats(t, pxu)
+	if stats.Pv != DefaultPlant.Ambient || stats.RS != Run || stats.VUnit != "C" {
+		t.Errorf("expected a running unit at ambient, got %v", stats)
+	}
+}
+
+func TestSimulator_Control(t *testing.T) {
+	cooled := PlantModel{Ambient: 20, HeatingPower: 100, CoolingPower: 40, TimeConstant: 10 * time.Minute}
+
+	tests := []struct {
+		name      string
+		plant     PlantModel
+		tp        float64 // 0 for on/off control
+		sp        float64
+		tolerance float64
+		power     func(*Stats) bool
+	}{
+		{"pid heating", DefaultPlant, 5.0, 65.0, 0.2, func(s *Stats) bool { return math.Abs(s.Out1Power-45) < 1 && s.Out1 }},
+		{"on/off heating", DefaultPlant, 0, 65.0, DefaultSimulatorHysteresis + 0.2, func(s *Stats) bool { return s.Out1Power == 0 || s.Out1Power == 100 }},
+		{"pid cooling", cooled, 2.0, 4.0, 0.2, func(s *Stats) bool { return math.Abs(s.Out2Power-40) < 1 && s.Out1Power < 0 && s.Out2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pxu, clock := newSimulatedPxu(t, tt.plant)
+
+			pid := &PidParameters{TP: tt.tp, TI: uint16(tt.plant.TimeConstant.Seconds())}
+			if err := pxu.WritePid(pid); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := pxu.UpdateSetpoint(tt.sp); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			clock.Advance(10 * tt.plant.TimeConstant)
+			stats := readStats(t, pxu)
+			if math.Abs(stats.Pv-tt.sp) > tt.tolerance {
+				t.Errorf("expected PV within %.1f of %.1f, got %v", tt.tolerance, tt.sp, stats)
+			}
+			if !tt.power(stats) {
+				t.Errorf("unexpected output power %v", stats)
+			}
+		})
+	}
+}
+
+func TestSimulator_StopAndManual(t *testing.T) {
+	pxu, clock := newSimulatedPxu(t, DefaultPlant)
+
+	if err := pxu.UpdateSetpoint(80); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := pxu.Stop(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hot := readStats(t, pxu).Pv
+	clock.Advance(time.Hour)
+	stats := readStats(t, pxu)
+	if stats.Out1 || stats.Out1Power != 0 || stats.Pv >= hot {
+		t.Errorf("expected a stopped unit to cool down from %.1f, got %v", hot, stats)
+	}
+
+	if err := pxu.UpdateControllerStatus(uint16(Run)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.SetControlMode(ModeManual); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.SetManualOutput(30); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	clock.Advance(5 * time.Hour)
+	stats = readStats(t, pxu)
+	if stats.Mode != ModeManual || stats.Out1Power != 30 || math.Abs(stats.Pv-50) > 0.2 {
+		t.Errorf("expected 30%% to settle at 50.0, got %v", stats)
+	}
+}
+
+func TestSimulator_Profile(t *testing.T) {
+	pxu, clock := newSimulatedPxu(t, DefaultPlant)
+
+	mash := NewProfile(2, 3, 4, 0)
+	mash.Segments = []Segment{
+		{Id: 0, Sp: 52.0, T: 10.0},
+		{Id: 1, Sp: 67.0, T: 30.0},
+		{Id: 2, Sp: 67.0, T: 60.0},
+	}
+	mashOut := NewProfile(4, 1, LinkEnd, 0)
+	mashOut.Segments = []Segment{{Id: 0, Sp: 78.0, T: 10.0}}
+	for _, profile := range []*Profile{mash, mashOut} {
+		if err := pxu.WriteProfile(profile); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := pxu.StartProfile(2, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	steps := []struct {
+		after time.Duration
+		rs    RunStatus
+		pc    uint16
+		ps    uint16
+		sp    float64
+		psr   float64
+	}{
+		{5 * time.Minute, Run, 2, 0, 52.0, 5.0},
+		{20 * time.Minute, Run, 2, 1, 59.5, 15.0},
+		{45 * time.Minute, Run, 2, 2, 67.0, 30.0},
+		{35 * time.Minute, Run, 4, 0, 72.5, 5.0},
+		{10 * time.Minute, End, 4, 0, 78.0, 0},
+	}
+
+	for _, step := range steps {
+		clock.Advance(step.after)
+		stats := readStats(t, pxu)
+		if stats.RS != step.rs || stats.PC != step.pc || stats.PS != step.ps ||
+			math.Abs(stats.Sp-step.sp) > 0.1 || math.Abs(stats.PSR-step.psr) > 0.1 {
+			t.Fatalf("expected RS:%s PC:%d PS:%d SP:%.1f PSR:%.1f, got %v", step.rs, step.pc, step.ps, step.sp, step.psr, stats)
+		}
+	}
+}
+
+func TestSimulator_ProfileControl(t *testing.T) {
+	pxu, clock := newSimulatedPxu(t, DefaultPlant)
+
+	profile := NewProfile(0, 2, LinkStop, 0)
+	profile.Segments = []Segment{{Id: 0, Sp: 60.0, T: 30.0}, {Id: 1, Sp: 60.0, T: 30.0}}
+	profile.Settings = &ProfileSettings{InitialRampRate: 2.0}
+	if err := pxu.WriteProfile(profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.StartProfile(0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the setpoint ramps from PV at 2.0/min before the segment time starts
+	clock.Advance(10 * time.Minute)
+	stats := readStats(t, pxu)
+	if math.Abs(stats.Sp-40.0) > 0.1 || stats.PSR != 30.0 {
+		t.Fatalf("expected the initial ramp at 40.0, got %v", stats)
+	}
+
+	if err := pxu.PauseProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if stats := readStats(t, pxu); stats.RS != Pause || math.Abs(stats.Sp-40.0) > 0.1 {
+		t.Fatalf("expected the paused profile to hold 40.0, got %v", stats)
+	}
+	if err := pxu.ResumeProfile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := pxu.AdvanceSegment(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := readStats(t, pxu); stats.PS != 1 || stats.PSR != 30.0 {
+		t.Fatalf("expected segment 1 after the advance, got %v", stats)
+	}
+
+	clock.Advance(31 * time.Minute)
+	if stats := readStats(t, pxu); stats.RS != Stop {
+		t.Fatalf("expected the profile to stop at its end, got %v", stats)
+	}
+}
+
+func TestSimulator_GuaranteedSoak(t *testing.T) {
+	// too weak to get near the segment setpoint, so the soak never counts down
+	weak := PlantModel{Ambient: 20, HeatingPower: 30, TimeConstant: 5 * time.Minute}
+	pxu, clock := newSimulatedPxu(t, weak)
+
+	profile := NewProfile(0, 1, LinkEnd, 0)
+	profile.Segments = []Segment{{Id: 0, Sp: 70.0, T: 20.0}}
+	profile.Settings = &ProfileSettings{Deviation: 1.0, ErrorBandTime: 2.0}
+	if err := pxu.WriteProfile(profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.StartProfile(0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	stats := readStats(t, pxu)
+	if stats.RS != Run || math.Abs(stats.PSR-18.0) > 0.1 {
+		t.Errorf("expected the segment to hold after the error band time, got %v", stats)
+	}
+}
+
+func TestSimulator_Alarms(t *testing.T) {
+	pxu, clock := newSimulatedPxu(t, DefaultPlant)
+
+	alarms := []*AlarmConfig{
+		{Id: 0, Mode: AlarmAbsoluteHigh, Latch: true, Value: 50.0, Hysteresis: 2.0},
+		{Id: 1, Mode: AlarmBandOutside, Value: 5.0, Hysteresis: 1.0},
+	}
+	for _, cfg := range alarms {
+		if err := pxu.WriteAlarm(cfg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	steps := []struct {
+		name     string
+		action   func() error
+		after    time.Duration
+		expected AlarmStatus
+	}{
+		{"heating up", func() error { return pxu.UpdateSetpoint(60) }, time.Minute, AlarmStatus{Active: [AlarmCount]bool{false, true}}},
+		{"at setpoint", nil, 3 * time.Hour, AlarmStatus{Active: [AlarmCount]bool{true, false}}},
+		{"cooled down", pxu.Stop, 3 * time.Hour, AlarmStatus{Active: [AlarmCount]bool{false, true}, Latched: [AlarmCount]bool{true, false}}},
+		{"reset", func() error { return pxu.ResetAlarm(0) }, 0, AlarmStatus{Active: [AlarmCount]bool{false, true}}},
+	}
+
+	for _, step := range steps {
+		if step.action != nil {
+			if err := step.action(); err != nil {
+				t.Fatalf("%s: unexpected error: %v", step.name, err)
+			}
+		}
+		clock.Advance(step.after)
+
+		status, err := pxu.ReadAlarmStatus()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if status != step.expected {
+			t.Errorf("%s: expected %v, got %v", step.name, step.expected, status)
+		}
+	}
+}
+
+func TestSimulator_Autotune(t *testing.T) {
+	pxu, clock := newSimulatedPxu(t, DefaultPlant)
+	clock.tick = time.Minute
+
+	detuned := &PidParameters{TP: 40.0, TI: 60, TD: 10}
+	if err := pxu.WritePid(detuned); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.UpdateSetpoint(50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := pxu.Autotune(AutotuneOptions{PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Before != *detuned {
+		t.Errorf("expected %v before, got %v", detuned, result.Before)
+	}
+	if expected := (PidParameters{TP: 5.0, TI: 1800}); result.After != expected {
+		t.Errorf("expected %v after, got %v", expected, result.After)
+	}
+}
+
+func TestSimulator_Exceptions(t *testing.T) {
+	sim, err := NewSimulator(SimulatorOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		write    func() error
+		expected ExceptionCode
+	}{
+		{"read only", func() error { return sim.SetRegister(RegPV, 100) }, ExIllegalDataAddress},
+		{"out of range", func() error { return sim.SetRegister(RegControllerStatus, 9) }, ExIllegalDataValue},
+		{"one of many", func() error { return sim.SetRegisters(RegTP, []uint16{70, 100, 20, 0, 9}) }, ExIllegalDataValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exception *ExceptionError
+			if err := tt.write(); !errors.As(err, &exception) || exception.Code != tt.expected {
+				t.Errorf("expected exception %v, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	// the refused request left the registers alone
+	if tp, _ := sim.ReadRegister(RegTP); tp == 70 {
+		t.Error("expected a refused write not to change the registers")
+	}
+}
@@ -0,0 +1,349 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrDisconnected = errors.New("disconnected")
+
+// ConnState is the state of the connection a Supervisor looks after.
+type ConnState uint8
+
+const (
+	ConnConnected    ConnState = iota // requests are answered
+	ConnDegraded                      // requests time out or come back garbled, the transport itself is fine
+	ConnDisconnected                  // the transport failed and is being reopened
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnDegraded:
+		return "degraded"
+	case ConnDisconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("UNKNOWN (%d)", s)
+	}
+}
+
+// SupervisorOptions configures a Supervisor.
+type SupervisorOptions struct {
+	Dial          func() (Modbus, error) // opens a new client, e.g. with NewModbusDevice
+	Backoff       RetryPolicy            // delay between reconnect attempts, Retries is ignored
+	OnStateChange func(ConnState)        // called in order for every state change, may be nil
+
+	// TimeoutThreshold is the number of consecutive timeouts after which the transport is reopened,
+	// DefaultReconnectTimeouts when zero.  Fewer only mark the connection degraded.
+	TimeoutThreshold int
+}
+
+// Supervisor is a Modbus client which reopens the transport when it fails, e.g. because the USB-RS485 adapter was
+// reset.  Timeouts and garbled frames only mark the connection degraded, since on a multi-drop line they usually mean
+// a single unit is not answering, until TimeoutThreshold timeouts in a row.  Then, or when the transport fails with an
+// I/O error, the client is closed and reconnected in the background with backoff, re-applying the unit ID.  Requests
+// fail with ErrDisconnected until the client is back.  Other errors, e.g. invalid parameters, leave the state alone.
+type Supervisor struct {
+	dial      func() (Modbus, error)
+	backoff   RetryPolicy
+	threshold int
+
+	mu       sync.Mutex
+	client   Modbus
+	unitId   UnitId
+	hasUnit  bool
+	state    ConnState
+	closed   bool
+	lastErr  error
+	timeouts int // consecutive timeouts
+
+	events   chan ConnState
+	states   chan ConnState
+	onChange func(ConnState)
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewSupervisor opens the first client.  Failing to do so is returned as an error, later failures are handled by
+// reconnecting.
+func NewSupervisor(opts SupervisorOptions) (*Supervisor, error) {
+	if opts.Dial == nil {
+		return nil, fmt.Errorf("dial function cannot be nil")
+	}
+	if opts.Backoff == (RetryPolicy{}) {
+		opts.Backoff = DefaultRetryPolicy(0)
+	}
+	if err := opts.Backoff.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid backoff: %w", err)
+	}
+	if opts.TimeoutThreshold < 0 {
+		return nil, fmt.Errorf("timeout threshold must not be negative, got %d", opts.TimeoutThreshold)
+	}
+	if opts.TimeoutThreshold == 0 {
+		opts.TimeoutThreshold = DefaultReconnectTimeouts
+	}
+
+	client, err := opts.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Supervisor{
+		dial:      opts.Dial,
+		backoff:   opts.Backoff,
+		threshold: opts.TimeoutThreshold,
+		client:    client,
+		state:     ConnConnected,
+		events:    make(chan ConnState, 16),
+		states:    make(chan ConnState, 16),
+		onChange:  opts.OnStateChange,
+		stop:      make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.notify()
+	return s, nil
+}
+
+// State returns the current connection state.
+func (s *Supervisor) State() ConnState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// States delivers every state change.  Changes are dropped when the channel is not drained.  The channel is closed
+// by Close.
+func (s *Supervisor) States() <-chan ConnState {
+	return s.states
+}
+
+// setState records the new state and queues the notification.  s.mu must be held.
+func (s *Supervisor) setState(state ConnState) {
+	if s.state == state {
+		return
+	}
+	s.state = state
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- state:
+	default:
+		log.Printf("dropped connection state change to %v", state)
+	}
+}
+
+// notify delivers the state changes in order, so a slow callback does not hold up requests.
+func (s *Supervisor) notify() {
+	defer s.wg.Done()
+	defer close(s.states)
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case state := <-s.events:
+			if s.onChange != nil {
+				s.onChange(state)
+			}
+			select {
+			case s.states <- state:
+			default:
+			}
+		}
+	}
+}
+
+// do runs the request on the current client and updates the state from its outcome.
+func (s *Supervisor) do(request func(Modbus) error) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: supervisor closed", ErrDisconnected)
+	}
+	client := s.client
+	if client == nil {
+		err := s.lastErr
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %w", ErrDisconnected, err)
+	}
+	s.mu.Unlock()
+
+	err := request(client)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != client {
+		// another request found the transport dead in the meantime
+		return err
+	}
+
+	if errors.Is(err, ErrTimeout) {
+		s.timeouts++
+	} else if err == nil || IsTransient(err) || errors.Is(err, ErrException) {
+		s.timeouts = 0
+	}
+
+	switch {
+	case err == nil, errors.Is(err, ErrException):
+		s.setState(ConnConnected)
+	case IsTransient(err) && s.timeouts < s.threshold:
+		s.setState(ConnDegraded)
+	case errors.Is(err, ErrTimeout), transportFailed(err):
+		s.timeouts = 0
+		s.lastErr = err
+		s.client = nil
+		s.setState(ConnDisconnected)
+		log.Printf("modbus transport failed, reconnecting: %v", err)
+
+		s.wg.Add(1)
+		go s.reconnect(client)
+	}
+	return err
+}
+
+// transportFailed tells whether the error comes from the transport itself rather than the request: the port or
+// connection was closed or reset, or the adapter went away.
+func transportFailed(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, os.ErrClosed) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.ENXIO) ||
+		errors.Is(err, syscall.ENODEV) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		(errors.As(err, &netErr) && !netErr.Timeout())
+}
+
+// reconnect closes the failed client and dials until a new one is open, or the supervisor is closed.
+func (s *Supervisor) reconnect(failed Modbus) {
+	defer s.wg.Done()
+	_ = failed.Close()
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(s.backoff.Backoff(attempt)):
+		}
+
+		client, err := s.dial()
+		if err == nil {
+			err = s.restoreUnit(client)
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.lastErr = err
+			s.mu.Unlock()
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = client.Close()
+			return
+		}
+		s.client = client
+		s.lastErr = nil
+		s.setState(ConnConnected)
+		s.mu.Unlock()
+
+		log.Printf("modbus transport reconnected after %d attempts", attempt)
+		return
+	}
+}
+
+// restoreUnit applies the unit ID selected last to a new client.
+func (s *Supervisor) restoreUnit(client Modbus) error {
+	s.mu.Lock()
+	id, ok := s.unitId, s.hasUnit
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	if err := client.SetUnitId(id); err != nil {
+		_ = client.Close()
+		return fmt.Errorf("failed restoring unit %d: %w", id, err)
+	}
+	return nil
+}
+
+// SetUnitId selects the unit and remembers it for reconnects.
+func (s *Supervisor) SetUnitId(id UnitId) error {
+	s.mu.Lock()
+	s.unitId, s.hasUnit = id, true
+	s.mu.Unlock()
+
+	return s.do(func(client Modbus) error {
+		return client.SetUnitId(id)
+	})
+}
+
+func (s *Supervisor) ReadRegister(address uint16) (uint16, error) {
+	val := uint16(ErrVal)
+	err := s.do(func(client Modbus) error {
+		var err error
+		val, err = client.ReadRegister(address)
+		return err
+	})
+	return val, err
+}
+
+func (s *Supervisor) ReadRegisters(address, quantity uint16) ([]uint16, error) {
+	var regs []uint16
+	err := s.do(func(client Modbus) error {
+		var err error
+		regs, err = client.ReadRegisters(address, quantity)
+		return err
+	})
+	return regs, err
+}
+
+func (s *Supervisor) SetRegister(address uint16, value uint16) error {
+	return s.do(func(client Modbus) error {
+		return client.SetRegister(address, value)
+	})
+}
+
+func (s *Supervisor) SetRegisters(startAddr uint16, values []uint16) error {
+	return s.do(func(client Modbus) error {
+		return client.SetRegisters(startAddr, values)
+	})
+}
+
+// Close stops reconnecting and closes the client.
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	client := s.client
+	s.client = nil
+	close(s.stop)
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if client != nil {
+		return client.Close()
+	}
+	return nil
+}
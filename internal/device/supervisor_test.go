@@ -0,0 +1,204 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/simonvetter/modbus"
+)
+
+// errAdapterGone is what reading a serial port returns after the USB adapter was unplugged.
+var errAdapterGone = &os.PathError{Op: "read", Path: "/dev/ttyUSB0", Err: syscall.EIO}
+
+// dialer hands out mocks, failing the dials listed in fail.
+type dialer struct {
+	mu      sync.Mutex
+	dials   int
+	fail    map[int]bool
+	clients []*MockModbus
+}
+
+func (d *dialer) dial() (Modbus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dials++
+	if d.fail[d.dials] {
+		return nil, fmt.Errorf("dial %d: no such device", d.dials)
+	}
+	client := NewMockModbus()
+	d.clients = append(d.clients, client)
+	return client, nil
+}
+
+func (d *dialer) client(i int) *MockModbus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.clients[i]
+}
+
+// nextState waits for the next state change delivered by the supervisor.
+func nextState(t *testing.T, s *Supervisor) ConnState {
+	t.Helper()
+	select {
+	case state := <-s.States():
+		return state
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a state change")
+		return 0
+	}
+}
+
+func TestSupervisor_Reconnect(t *testing.T) {
+	d := &dialer{fail: map[int]bool{2: true}}
+	backoff := RetryPolicy{Base: time.Millisecond, Max: time.Millisecond, Multiplier: 1}
+
+	var mu sync.Mutex
+	var changes []ConnState
+	s, err := NewSupervisor(SupervisorOptions{
+		Dial:    d.dial,
+		Backoff: backoff,
+		OnStateChange: func(state ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, state)
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create supervisor: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.SetUnitId(7); err != nil {
+		t.Fatalf("failed to set unit id: %v", err)
+	}
+
+	// the adapter goes away
+	d.client(0).SimulateFailure(errAdapterGone)
+	if _, err := s.ReadRegisters(RegPV, 1); err == nil {
+		t.Fatal("expected the read on the failed transport to fail")
+	}
+	if state := nextState(t, s); state != ConnDisconnected {
+		t.Fatalf("expected %v, got %v", ConnDisconnected, state)
+	}
+	if state := nextState(t, s); state != ConnConnected {
+		t.Fatalf("expected %v, got %v", ConnConnected, state)
+	}
+
+	// the first redial failed, the second one got a new client with the unit restored
+	if d.dials != 3 {
+		t.Errorf("expected 3 dials, got %d", d.dials)
+	}
+	if id := d.client(1).unitId; id != 7 {
+		t.Errorf("expected unit 7 on the new client, got %d", id)
+	}
+	if _, err := s.ReadRegisters(RegPV, 1); err != nil {
+		t.Errorf("unexpected error after reconnecting: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(changes) != fmt.Sprint([]ConnState{ConnDisconnected, ConnConnected}) {
+		t.Errorf("unexpected state changes %v", changes)
+	}
+}
+
+func TestSupervisor_States(t *testing.T) {
+	client := &failingModbus{MockModbus: NewMockModbus()}
+	s, err := NewSupervisor(SupervisorOptions{Dial: func() (Modbus, error) { return client, nil }})
+	if err != nil {
+		t.Fatalf("failed to create supervisor: %v", err)
+	}
+	defer s.Close()
+
+	client.err = ErrTimeout
+	_, _ = s.ReadRegisters(RegPV, 1)
+	if state := s.State(); state != ConnDegraded {
+		t.Errorf("expected a timeout to degrade the connection, got %v", state)
+	}
+
+	client.err = &ExceptionError{Code: ExIllegalDataAddress}
+	_, _ = s.ReadRegisters(RegPV, 1)
+	if state := s.State(); state != ConnConnected {
+		t.Errorf("expected an exception to prove the connection, got %v", state)
+	}
+}
+
+func TestSupervisor_Disconnected(t *testing.T) {
+	d := &dialer{fail: map[int]bool{2: true, 3: true, 4: true, 5: true}}
+	s, err := NewSupervisor(SupervisorOptions{
+		Dial:    d.dial,
+		Backoff: RetryPolicy{Base: time.Hour, Max: time.Hour, Multiplier: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to create supervisor: %v", err)
+	}
+
+	d.client(0).SimulateFailure(errAdapterGone)
+	_, _ = s.ReadRegisters(RegPV, 1)
+
+	if err := s.SetRegister(RegSP, 1); !errors.Is(err, ErrDisconnected) {
+		t.Errorf("expected ErrDisconnected, got %v", err)
+	}
+
+	// closing ends the reconnect waiting for its backoff
+	done := make(chan error)
+	go func() { done <- s.Close() }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected close to stop reconnecting")
+	}
+}
+
+func TestSupervisor_Failures(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		times     int
+		expected  ConnState
+		reconnect bool
+	}{
+		{"adapter gone", errAdapterGone, 1, ConnDisconnected, true},
+		{"connection closed", io.EOF, 1, ConnDisconnected, true},
+		{"timeouts below the threshold", ErrTimeout, 2, ConnDegraded, false},
+		{"timeouts reaching the threshold", ErrTimeout, 3, ConnDisconnected, true},
+		{"invalid parameters", modbus.ErrUnexpectedParameters, 1, ConnConnected, false},
+		{"validation", errors.New("quantity out of range"), 1, ConnConnected, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &dialer{}
+			s, err := NewSupervisor(SupervisorOptions{
+				Dial:             d.dial,
+				Backoff:          RetryPolicy{Base: time.Hour, Max: time.Hour, Multiplier: 1},
+				TimeoutThreshold: 3,
+			})
+			if err != nil {
+				t.Fatalf("failed to create supervisor: %v", err)
+			}
+			defer s.Close()
+
+			d.client(0).SimulateFailure(tt.err)
+			for i := 0; i < tt.times; i++ {
+				if _, err := s.ReadRegisters(RegPV, 1); !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v passed through, got %v", tt.err, err)
+				}
+			}
+
+			if state := s.State(); state != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, state)
+			}
+			if _, err := s.ReadRegisters(RegPV, 1); errors.Is(err, ErrDisconnected) != tt.reconnect {
+				t.Errorf("expected reconnecting %v, got %v", tt.reconnect, err)
+			}
+		})
+	}
+}
@@ -3,27 +3,31 @@ package device
 import (
 	"fmt"
 	"strings"
-	"time"
 )
 
 type Stats struct {
-	Pv     float64   `json:"pv"`
-	Sp     float64   `json:"sp"`
-	Out1   bool      `json:"out1"`
-	Out2   bool      `json:"out2"`
-	At     bool      `json:"at"`
-	TP     float64   `json:"tp"`
-	TI     uint16    `json:"ti"`
-	TD     uint16    `json:"td"`
-	TGroup uint16    `json:"tgroup"`
-	RS     RunStatus `json:"rs"`
-	VUnit  string    `json:"vunit"`
-	PC     uint16    `json:"pc"`
-	PS     uint16    `json:"ps"`
-	PSR    float64   `json:"psr"`
-}
-
-func NewStats(regs []uint16) (*Stats, error) {
+	Pv        float64     `json:"pv"`
+	Sp        float64     `json:"sp"`
+	Out1      bool        `json:"out1"`
+	Out2      bool        `json:"out2"`
+	Out1Power float64     `json:"out1power"`
+	Out2Power float64     `json:"out2power"`
+	Mode      ControlMode `json:"mode"`
+	At        bool        `json:"at"`
+	TP        float64     `json:"tp"`
+	TI        uint16      `json:"ti"`
+	TD        uint16      `json:"td"`
+	TGroup    uint16      `json:"tgroup"`
+	RS        RunStatus   `json:"rs"`
+	VUnit     string      `json:"vunit"`
+	PC        uint16      `json:"pc"`
+	PS        uint16      `json:"ps"`
+	PSR       float64     `json:"psr"`
+	Alarms    AlarmStatus `json:"alarms"`
+}
+
+// NewStats decodes the stats registers, using scale for the process values.
+func NewStats(regs []uint16, scale Scale) (*Stats, error) {
 	ledStatus := regs[RegLED]
 
 	unit, err := parseTemperatureUnit(ledStatus)
@@ -32,20 +36,24 @@ func NewStats(regs []uint16) (*Stats, error) {
 	}
 
 	return &Stats{
-		Pv:     toFloat(regs[RegPV]),
-		Sp:     toFloat(regs[RegSP]),
-		Out1:   ledStatus&LEDOut1 != 0,
-		Out2:   ledStatus&LEDOut2 != 0,
-		At:     ledStatus&LEDAt != 0,
-		TP:     toFloat(regs[RegTP]),
-		TI:     regs[RegTI],
-		TD:     regs[RegTD],
-		TGroup: regs[RegTGroup],
-		RS:     RunStatus(regs[RegControllerStatus]),
-		VUnit:  unit,
-		PC:     regs[RegPC],
-		PS:     regs[RegPS],
-		PSR:    toFloat(regs[RegPSR]),
+		Pv:        decodeRegister(regs, 0, "pv", scale),
+		Sp:        decodeRegister(regs, 0, "sp", scale),
+		Out1:      ledStatus&LEDOut1 != 0,
+		Out2:      ledStatus&LEDOut2 != 0,
+		Out1Power: decodeRegister(regs, 0, "op1", scale),
+		Out2Power: decodeRegister(regs, 0, "op2", scale),
+		Mode:      ControlMode(regs[RegControlMode]),
+		At:        ledStatus&LEDAt != 0,
+		TP:        decodeRegister(regs, 0, "tp", scale),
+		TI:        regs[RegTI],
+		TD:        regs[RegTD],
+		TGroup:    regs[RegTGroup],
+		RS:        RunStatus(regs[RegControllerStatus]),
+		VUnit:     unit,
+		PC:        regs[RegPC],
+		PS:        regs[RegPS],
+		PSR:       decodeRegister(regs, 0, "psr", scale),
+		Alarms:    NewAlarmStatus(regs[RegAlarmStatus]),
 	}, nil
 }
 
@@ -67,13 +75,15 @@ func parseTemperatureUnit(ledStatus uint16) (string, error) {
 
 func (s Stats) String() string {
 	return fmt.Sprintf(
-		"PV:%.1f%s SP:%.1f%s | Out1:%t Out2:%t AT:%t | TP:%.1f TI:%d TD:%d TGroup:%d | RS:%s | PC:%d PS:%d PSR:%.1f",
+		"PV:%.1f%s SP:%.1f%s | Out1:%t Out2:%t AT:%t | Power:%.1f%%/%.1f%% %s | TP:%.1f TI:%d TD:%d TGroup:%d | RS:%s | PC:%d PS:%d PSR:%.1f | %s",
 		s.Pv, s.VUnit,
 		s.Sp, s.VUnit,
 		s.Out1, s.Out2, s.At,
+		s.Out1Power, s.Out2Power, s.Mode,
 		s.TP, s.TI, s.TD, s.TGroup,
 		s.RS,
 		s.PC, s.PS, s.PSR,
+		s.Alarms,
 	)
 }
 
@@ -89,7 +99,7 @@ func NewInfo(regs []uint16) (*Info, error) {
 		model.WriteString(toString(regs[i]))
 	}
 
-	firmware := fmt.Sprintf("%.2f", float64(regs[l])/100)
+	firmware := fmt.Sprintf("%.2f", decodeRegister(regs, RegInfoStart, "firmware", DefaultScale))
 
 	return &Info{
 		Model:    strings.TrimSpace(model.String()),
@@ -129,14 +139,45 @@ func (s RunStatus) String() string {
 	}
 }
 
-// Configuration stores the settings for communication with serial devices.
-// Example URL:  rtu://COM3 (windows), rtu:///dev/ttyUSB0 (Linux).
-type Configuration struct {
-	URL      string
-	Speed    uint
-	DataBits uint
-	Parity   string
-	Timeout  time.Duration
+// PidParameters holds one PID parameter set of the controller.
+type PidParameters struct {
+	Group uint16  `json:"group"` // Parameter Set
+	TP    float64 `json:"tp"`    // Proportional Band
+	TI    uint16  `json:"ti"`    // Integral Time
+	TD    uint16  `json:"td"`    // Derivative Time
+}
+
+func (p PidParameters) String() string {
+	return fmt.Sprintf("TGroup:%d TP:%.1f TI:%d TD:%d", p.Group, p.TP, p.TI, p.TD)
+}
+
+func (p PidParameters) validate() error {
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"tgroup", float64(p.Group)},
+		{"tp", p.TP},
+		{"ti", float64(p.TI)},
+		{"td", float64(p.TD)},
+	}
+	for _, v := range values {
+		if err := mustLookupRegister(v.name).Validate(v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunStatusError reports that the controller did not switch to the requested run status.
+type RunStatusError struct {
+	Unit UnitId
+	Want RunStatus
+	Got  RunStatus
+}
+
+func (e *RunStatusError) Error() string {
+	return fmt.Sprintf("unit %d reports run status %s, expected %s", e.Unit, e.Got, e.Want)
 }
 
 type Segment struct {
@@ -155,6 +196,10 @@ type Profile struct {
 	link     uint16
 	Segments []Segment
 	repeat   uint16
+
+	// Settings are shared by every profile on the device.  They are filled in when reading a profile; when writing,
+	// nil leaves the settings on the device alone.
+	Settings *ProfileSettings
 }
 
 func (p Profile) String() string {
@@ -166,8 +211,64 @@ func (p Profile) String() string {
 	} else {
 		linkVal = fmt.Sprintf("PROFILE %d", p.link)
 	}
-	return fmt.Sprintf("Id: %d, SegCount: %d, Link: %s, Repeat: %d, Segments: %+v",
+	s := fmt.Sprintf("Id: %d, SegCount: %d, Link: %s, Repeat: %d, Segments: %+v",
 		p.Id, p.SegCount, linkVal, p.repeat, p.Segments)
+	if p.Settings != nil {
+		s += fmt.Sprintf(", Settings: %v", p.Settings)
+	}
+	return s
+}
+
+// Link returns the profile which runs after this one, or LinkEnd/LinkStop.
+func (p Profile) Link() uint16 {
+	return p.link
+}
+
+// Repeat returns how often the profile repeats (0 = no repeat).
+func (p Profile) Repeat() uint16 {
+	return p.repeat
+}
+
+// ProfileSettings control how every profile on the device runs.
+type ProfileSettings struct {
+	Deviation       float64 // guaranteed soak band around the segment setpoint in process units, 0 disables it
+	ErrorBandTime   float64 // minutes the process value may be outside the band before the segment time stops
+	InitialRampRate float64 // process units per minute to ramp from the process value to the first setpoint, 0 jumps
+}
+
+func (s ProfileSettings) String() string {
+	return fmt.Sprintf("Deviation: %.1f, ErrorBandTime: %.1f, InitialRampRate: %.1f", s.Deviation, s.ErrorBandTime, s.InitialRampRate)
+}
+
+// encode validates the settings and converts them into the registers starting at RegProfDEV.
+func (s ProfileSettings) encode(scale Scale) ([]uint16, error) {
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"dev", s.Deviation},
+		{"ebt", s.ErrorBandTime},
+		{"irr", s.InitialRampRate},
+	}
+
+	regs := make([]uint16, 0, len(values))
+	for _, v := range values {
+		reg, err := mustLookupRegister(v.name).Encode(v.value, scale)
+		if err != nil {
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+// newProfileSettings decodes the registers starting at RegProfDEV.
+func newProfileSettings(regs []uint16, scale Scale) *ProfileSettings {
+	return &ProfileSettings{
+		Deviation:       decodeRegister(regs, RegProfDEV, "dev", scale),
+		ErrorBandTime:   decodeRegister(regs, RegProfDEV, "ebt", scale),
+		InitialRampRate: decodeRegister(regs, RegProfDEV, "irr", scale),
+	}
 }
 
 func NewProfile(id uint16, segmentCount, linkProfile, repeatCycle uint16) *Profile {
@@ -3,7 +3,6 @@ package device
 import (
 	"encoding/hex"
 	"fmt"
-	"math"
 )
 
 func makeProfile(regs []uint16) string {
@@ -20,13 +19,6 @@ func toFloat(r uint16) float64 {
 	return float64(r) / 10
 }
 
-func toUint16(r float64) uint16 {
-	scaled := r * 10.0
-	truncated := math.Floor(scaled)
-
-	return uint16(truncated)
-}
-
 func toString(input uint16) string {
 	r := fmt.Sprintf("%04x", input) // Ensure 4 digits with leading zeros
 	bs, err := hex.DecodeString(r)
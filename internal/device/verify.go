@@ -0,0 +1,181 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+var ErrWriteMismatch = errors.New("write not confirmed")
+
+// WriteMismatchError describes a register which reads back a different value than was written.  Expected and Actual
+// are in engineering units when Name is set, raw values otherwise.  It matches ErrWriteMismatch.
+type WriteMismatchError struct {
+	Unit     UnitId // 0 when the unit is not known
+	Address  uint16
+	Name     string // set for registers in the RegisterMap, read back through a Pxu
+	Expected float64
+	Actual   float64
+}
+
+func (e *WriteMismatchError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = fmt.Sprintf("register %d", e.Address)
+	}
+	msg := fmt.Sprintf("%s %s: wrote %v, read back %v", name, ErrWriteMismatch, e.Expected, e.Actual)
+	if e.Unit == 0 {
+		return msg
+	}
+	return fmt.Sprintf("unit %d: %s", e.Unit, msg)
+}
+
+func (e *WriteMismatchError) Is(target error) bool {
+	return target == ErrWriteMismatch
+}
+
+// ReadBackError lists every register of a write which reads back a different value than was written.  It matches
+// ErrWriteMismatch, and errors.As finds each *WriteMismatchError in it.
+type ReadBackError struct {
+	Mismatches []WriteMismatchError
+}
+
+func (e *ReadBackError) Error() string {
+	if len(e.Mismatches) == 1 {
+		return e.Mismatches[0].Error()
+	}
+
+	msgs := make([]string, len(e.Mismatches))
+	for i := range e.Mismatches {
+		msgs[i] = e.Mismatches[i].Error()
+	}
+	return fmt.Sprintf("%d registers %s: %s", len(e.Mismatches), ErrWriteMismatch, strings.Join(msgs, "; "))
+}
+
+func (e *ReadBackError) Is(target error) bool {
+	return target == ErrWriteMismatch
+}
+
+func (e *ReadBackError) Unwrap() []error {
+	errs := make([]error, len(e.Mismatches))
+	for i := range e.Mismatches {
+		errs[i] = &e.Mismatches[i]
+	}
+	return errs
+}
+
+// VerifyStats counts the writes checked in write-verify mode.
+type VerifyStats struct {
+	Verified   uint64 // writes read back
+	Mismatches uint64 // read backs which differed, including those fixed by writing again
+}
+
+func (s VerifyStats) String() string {
+	return fmt.Sprintf("Verified: %d, Mismatches: %d", s.Verified, s.Mismatches)
+}
+
+// writeVerifier counts the verified writes of a unit.
+type writeVerifier struct {
+	verified   atomic.Uint64
+	mismatches atomic.Uint64
+}
+
+// EnableWriteVerify turns write-verify mode on or off.  In write-verify mode every register written is read back and
+// compared after scaling.  A mismatch is written again as often as the retry policy allows, then returned as a
+// *ReadBackError.  Registers marked Volatile, like the alarm reset and the controller status, are not verified since
+// they do not read back what was written.
+func (p *Pxu) EnableWriteVerify(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if enabled && p.verifier == nil {
+		p.verifier = &writeVerifier{}
+	} else if !enabled {
+		p.verifier = nil
+	}
+}
+
+// VerifyStats returns the write-verify counters, zero when write-verify mode is off.
+func (p *Pxu) VerifyStats() VerifyStats {
+	v := p.writeVerifier()
+	if v == nil {
+		return VerifyStats{}
+	}
+	return VerifyStats{Verified: v.verified.Load(), Mismatches: v.mismatches.Load()}
+}
+
+func (p *Pxu) writeVerifier() *writeVerifier {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.verifier
+}
+
+// verifyWrite runs write and, in write-verify mode, reads the values back, repeating the write on a mismatch.
+func (p *Pxu) verifyWrite(ctx context.Context, addr uint16, values []uint16, write func() error) error {
+	v := p.writeVerifier()
+	if v == nil || !verifiable(addr, len(values)) {
+		return write()
+	}
+
+	policy, _ := p.settings()
+	for attempt := 0; ; attempt++ {
+		if err := write(); err != nil {
+			return err
+		}
+
+		// straight from the device, the cache may still hold the old values
+		regs, err := p.readRegisters(ctx, addr, uint16(len(values)))
+		if err != nil {
+			return fmt.Errorf("failed reading back register %d: %w", addr, err)
+		}
+		v.verified.Add(1)
+
+		mismatch := p.compareWrite(addr, values, regs)
+		if mismatch == nil {
+			return nil
+		}
+		v.mismatches.Add(1)
+
+		if attempt >= policy.Retries {
+			return mismatch
+		}
+		log.Printf("%v, writing again", mismatch)
+	}
+}
+
+// compareWrite returns the registers which do not read back the values written, compared after scaling.
+func (p *Pxu) compareWrite(addr uint16, values, regs []uint16) *ReadBackError {
+	var mismatches []WriteMismatchError
+	for i, value := range values {
+		if regs[i] == value {
+			continue
+		}
+
+		address := addr + uint16(i)
+		mismatch := WriteMismatchError{Unit: p.id, Address: address, Expected: float64(value), Actual: float64(regs[i])}
+		if r, ok := registerAt(address); ok {
+			mismatch.Name = r.Name
+			mismatch.Expected = r.Decode(value, p.Scale())
+			mismatch.Actual = r.Decode(regs[i], p.Scale())
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+	return &ReadBackError{Mismatches: mismatches}
+}
+
+// verifiable tells whether the registers read back what was written to them.
+func verifiable(addr uint16, count int) bool {
+	for i := range count {
+		if r, ok := registerAt(addr + uint16(i)); ok && r.Volatile {
+			return false
+		}
+	}
+	return true
+}
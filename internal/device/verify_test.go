@@ -0,0 +1,206 @@
+package device
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// clampingModbus stores value instead of what is written to addr, for the first times writes.
+type clampingModbus struct {
+	*MockModbus
+	addr  uint16
+	value uint16
+	times int
+}
+
+func (m *clampingModbus) SetRegister(address, value uint16) error {
+	if address == m.addr && m.times > 0 {
+		m.times--
+		value = m.value
+	}
+	return m.MockModbus.SetRegister(address, value)
+}
+
+func TestPxu_WriteVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		times    int // writes the device gets wrong
+		expected VerifyStats
+		err      bool
+	}{
+		{"confirmed", 0, VerifyStats{Verified: 1}, false},
+		{"fixed by writing again", 1, VerifyStats{Verified: 2, Mismatches: 1}, false},
+		{"never confirmed", 10, VerifyStats{Verified: 3, Mismatches: 3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &clampingModbus{MockModbus: NewMockModbus(), addr: RegSP, value: 300, times: tt.times}
+			pxu, err := NewPxu(1, mock, time.Second, 2)
+			if err != nil {
+				t.Fatalf("failed to create PXU: %v", err)
+			}
+			pxu.EnableWriteVerify(true)
+
+			err = pxu.UpdateSetpoint(35)
+			if stats := pxu.VerifyStats(); stats != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, stats)
+			}
+
+			if !tt.err {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var mismatch *WriteMismatchError
+			if !errors.Is(err, ErrWriteMismatch) || !errors.As(err, &mismatch) {
+				t.Fatalf("expected a WriteMismatchError, got %v", err)
+			}
+			want := WriteMismatchError{Unit: 1, Address: RegSP, Name: "sp", Expected: 35, Actual: 30}
+			if *mismatch != want {
+				t.Errorf("expected %+v, got %+v", want, *mismatch)
+			}
+		})
+	}
+}
+
+// ignoringModbus keeps its values in the registers given, whatever is written to them.
+type ignoringModbus struct {
+	*MockModbus
+	ignored map[uint16]bool
+}
+
+func (m *ignoringModbus) SetRegisters(startAddr uint16, values []uint16) error {
+	for i, value := range values {
+		if addr := startAddr + uint16(i); !m.ignored[addr] {
+			_ = m.MockModbus.SetRegister(addr, value)
+		}
+	}
+	return nil
+}
+
+func TestPxu_WriteVerifyBlock(t *testing.T) {
+	mock := &ignoringModbus{MockModbus: NewMockModbus(), ignored: map[uint16]bool{RegTI: true, RegTD: true}}
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	pxu.EnableWriteVerify(true)
+
+	err = pxu.WritePid(&PidParameters{TP: 4.2, TI: 300, TD: 75})
+
+	var rbErr *ReadBackError
+	if !errors.Is(err, ErrWriteMismatch) || !errors.As(err, &rbErr) {
+		t.Fatalf("expected a ReadBackError, got %v", err)
+	}
+	expected := []WriteMismatchError{
+		{Unit: 1, Address: RegTI, Name: "ti", Expected: 300, Actual: 0},
+		{Unit: 1, Address: RegTD, Name: "td", Expected: 75, Actual: 0},
+	}
+	if !slices.Equal(rbErr.Mismatches, expected) {
+		t.Errorf("expected every mismatch %+v, got %+v", expected, rbErr.Mismatches)
+	}
+
+	var mismatch *WriteMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Address != RegTI {
+		t.Errorf("expected the first mismatch, got %v", mismatch)
+	}
+}
+
+func TestPxu_WriteVerifySkipped(t *testing.T) {
+	mock := &countingModbus{MockModbus: NewMockModbus()}
+	pxu, err := NewPxu(1, mock, time.Second, 1)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+
+	// off by default
+	if err := pxu.UpdateSetpoint(35); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reads := mock.reads.Load(); reads != 0 {
+		t.Errorf("expected no read back, got %d reads", reads)
+	}
+
+	// commands do not read back what was written
+	pxu.EnableWriteVerify(true)
+	if err := pxu.ResetAlarms(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.StartAutotune(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := pxu.VerifyStats(); stats.Verified != 0 {
+		t.Errorf("expected no verified writes, got %v", stats)
+	}
+
+	// multi-register writes are verified as a whole
+	if err := pxu.WriteAlarm(&AlarmConfig{Id: 1, Mode: AlarmAbsoluteHigh, Value: 30}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats := pxu.VerifyStats(); stats.Verified != 1 {
+		t.Errorf("expected 1 verified write, got %v", stats)
+	}
+
+	pxu.EnableWriteVerify(false)
+	if stats := pxu.VerifyStats(); stats != (VerifyStats{}) {
+		t.Errorf("expected zero stats when off, got %v", stats)
+	}
+}
+
+func TestRegisterAt(t *testing.T) {
+	tests := []struct {
+		addr  uint16
+		name  string
+		found bool
+	}{
+		{RegSP, "sp", true},
+		{RegProfLink + 3, "link[3]", true},
+		{RegAlarmStart + AlarmRegStride + 2, "alval[1]", true},
+		{RegProfSegmentStart + 2*17 + 1, "segtime[17]", true},
+		{RegAlarmStart + 5, "", false},
+		{9999, "", false},
+	}
+
+	for _, tt := range tests {
+		r, ok := registerAt(tt.addr)
+		if ok != tt.found || r.Name != tt.name {
+			t.Errorf("address %d: expected %q (%t), got %q (%t)", tt.addr, tt.name, tt.found, r.Name, ok)
+		}
+		if ok && r.Address != tt.addr {
+			t.Errorf("address %d: got register at %d", tt.addr, r.Address)
+		}
+	}
+}
+
+func TestPxu_WriteVerifyAdvance(t *testing.T) {
+	pxu, _ := newSimulatedPxu(t, DefaultPlant)
+	pxu.EnableWriteVerify(true)
+
+	profile := NewProfile(0, 6, LinkEnd, 0)
+	for i := range uint8(6) {
+		profile.Segments = append(profile.Segments, Segment{Id: i, Sp: 60.0, T: 30.0})
+	}
+	if err := pxu.WriteProfile(profile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := pxu.StartProfile(0, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the advance command reads back as RUN, and must be sent once
+	if err := pxu.Set("rs", RsAdvance); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stats := readStats(t, pxu)
+	if stats.RS != Run || stats.PS != 1 {
+		t.Errorf("expected RUN in segment 1, got %v", stats)
+	}
+	if mismatches := pxu.VerifyStats().Mismatches; mismatches != 0 {
+		t.Errorf("expected no mismatches, got %d", mismatches)
+	}
+}
@@ -2,9 +2,14 @@ package api
 
 import (
 	"context"
+	"errors"
 	"github.com/nguba/RedLionPXU/internal/device"
 	v2 "github.com/nguba/RedLionPXU/public/api/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 	"log"
 	"net"
 )
@@ -14,24 +19,92 @@ type Server struct {
 	pid        *device.Pxu
 	listener   net.Listener
 	grpcServer *grpc.Server
+	health     *health.Server
 }
 
 func NewServer(pxu *device.Pxu, listener net.Listener) (*Server, error) {
 	srv := grpc.NewServer()
-	svc := &Server{pid: pxu, listener: listener, grpcServer: srv}
+	svc := &Server{pid: pxu, listener: listener, grpcServer: srv, health: health.NewServer()}
 	v2.RegisterRedLionPxuServer(srv, svc)
+	healthpb.RegisterHealthServer(srv, svc.health)
 	return svc, nil
 }
 
-func (s *Server) GetStats(_ context.Context, in *v2.GetStatsRequest) (*v2.GetStatsResponse, error) {
-	stats, err := s.pid.ReadStats()
+// SetConnState reports the state of the connection to the device through the gRPC health service.  A degraded
+// connection still serves requests, a disconnected one does not.
+func (s *Server) SetConnState(state device.ConnState) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if state == device.ConnDisconnected {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", status)
+	s.health.SetServingStatus(v2.RedLionPxu_ServiceDesc.ServiceName, status)
+}
+
+func (s *Server) GetStats(ctx context.Context, in *v2.GetStatsRequest) (*v2.GetStatsResponse, error) {
+	stats, err := s.pid.ReadStatsContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return makeGetStatsResponse(stats), nil
 }
 
+func (s *Server) GetParameter(ctx context.Context, in *v2.GetParameterRequest) (*v2.GetParameterResponse, error) {
+	r, err := device.LookupRegister(in.GetName())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	val, err := s.pid.GetContext(ctx, r.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &v2.GetParameterResponse{Parameter: makeParameter(r, val)}, nil
+}
+
+func (s *Server) SetParameter(ctx context.Context, in *v2.SetParameterRequest) (*v2.SetParameterResponse, error) {
+	r, err := device.LookupRegister(in.GetName())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if r.Access != device.ReadWrite {
+		return nil, status.Error(codes.PermissionDenied, device.ErrReadOnlyRegister.Error())
+	}
+	if err := r.Validate(in.GetValue()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.pid.SetContext(withOverride(ctx, in.GetOverrideReason()), r.Name, in.GetValue()); err != nil {
+		return nil, setError(err)
+	}
+	return &v2.SetParameterResponse{Parameter: makeParameter(r, in.GetValue())}, nil
+}
+
+func (s *Server) SetSetpoint(ctx context.Context, in *v2.SetSetpointRequest) (*v2.SetSetpointResponse, error) {
+	if err := s.pid.UpdateSetpointContext(withOverride(ctx, in.GetOverrideReason()), in.GetSetpoint()); err != nil {
+		return nil, setError(err)
+	}
+	return &v2.SetSetpointResponse{Success: true}, nil
+}
+
+// withOverride lets the write through the safety envelope when the request gives a reason.
+func withOverride(ctx context.Context, reason string) context.Context {
+	if reason == "" {
+		return ctx
+	}
+	return device.WithOverride(ctx, reason)
+}
+
+// setError maps a write refused by the safety envelope to a failed precondition.
+func setError(err error) error {
+	if errors.Is(err, device.ErrOutsideEnvelope) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return err
+}
+
 func (s *Server) Stop() {
+	s.health.Shutdown()
 	s.grpcServer.Stop()
 	_ = s.listener.Close()
 	log.Printf("Stopped gRPC server on: %v", s.listener.Addr())
@@ -47,21 +120,30 @@ func (s *Server) Start() error {
 	return nil
 }
 
+func makeParameter(r device.Register, value float64) *v2.Parameter {
+	return &v2.Parameter{Name: r.Name, Value: value, Unit: r.Unit}
+}
+
 func makeGetStatsResponse(stats *device.Stats) *v2.GetStatsResponse {
 	return &v2.GetStatsResponse{Stats: &v2.Stats{
-		Pv:     stats.Pv,
-		Sp:     stats.Sp,
-		Out1:   stats.Out1,
-		Out2:   stats.Out2,
-		At:     stats.At,
-		Tp:     stats.TP,
-		Ti:     uint32(stats.TI),
-		Td:     uint32(stats.TD),
-		TGroup: uint32(stats.TGroup),
-		Rs:     stats.RS.String(),
-		Vunit:  stats.VUnit,
-		Pc:     uint32(stats.PC),
-		Ps:     uint32(stats.PS),
-		Psr:    stats.PSR,
+		Pv:           stats.Pv,
+		Sp:           stats.Sp,
+		Out1:         stats.Out1,
+		Out2:         stats.Out2,
+		At:           stats.At,
+		Tp:           stats.TP,
+		Ti:           uint32(stats.TI),
+		Td:           uint32(stats.TD),
+		TGroup:       uint32(stats.TGroup),
+		Rs:           stats.RS.String(),
+		Vunit:        stats.VUnit,
+		Pc:           uint32(stats.PC),
+		Ps:           uint32(stats.PS),
+		Psr:          stats.PSR,
+		AlarmActive:  stats.Alarms.Active[:],
+		AlarmLatched: stats.Alarms.Latched[:],
+		Out1Power:    stats.Out1Power,
+		Out2Power:    stats.Out2Power,
+		Mode:         stats.Mode.String(),
 	}}
 }
@@ -5,7 +5,9 @@ import (
 	"github.com/nguba/RedLionPXU/internal/device"
 	v2 "github.com/nguba/RedLionPXU/public/api/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	"log"
 	"net"
@@ -100,3 +102,62 @@ func TestApi_GetStats(t *testing.T) {
 	}
 	t.Log(got)
 }
+
+func TestApi_Parameters(t *testing.T) {
+	client := setupTestServer(t)
+	t.Cleanup(func() {
+		modbus.Reset()
+	})
+
+	_, err := client.SetParameter(context.Background(), &v2.SetParameterRequest{Name: "sp", Value: -1.5})
+	if err != nil {
+		t.Fatalf("SetParameter failed: %v", err)
+	}
+
+	got, err := client.GetParameter(context.Background(), &v2.GetParameterRequest{Name: "sp"})
+	if err != nil {
+		t.Fatalf("GetParameter failed: %v", err)
+	}
+	if got.Parameter.Value != -1.5 {
+		t.Errorf("GetParameter returned wrong sp: %v", got.Parameter.Value)
+	}
+
+	_, err = client.SetParameter(context.Background(), &v2.SetParameterRequest{Name: "pv", Value: 20})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("SetParameter on read only register returned: %v", err)
+	}
+
+	_, err = client.GetParameter(context.Background(), &v2.GetParameterRequest{Name: "bogus"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetParameter on unknown register returned: %v", err)
+	}
+}
+
+func TestApi_SetpointOverride(t *testing.T) {
+	pxu, err := device.NewPxu(unit, device.NewMockModbus(), time.Second, 3)
+	if err != nil {
+		t.Fatalf("failed to create PXU: %v", err)
+	}
+	if err := pxu.SetSafetyEnvelope(&device.SafetyEnvelope{Min: 0, Max: 80}); err != nil {
+		t.Fatalf("failed to set envelope: %v", err)
+	}
+	svc := &Server{pid: pxu}
+
+	_, err = svc.SetSetpoint(context.Background(), &v2.SetSetpointRequest{Setpoint: 90})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("SetSetpoint outside the envelope returned: %v", err)
+	}
+	_, err = svc.SetParameter(context.Background(), &v2.SetParameterRequest{Name: "segsp[3]", Value: 90})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("SetParameter outside the envelope returned: %v", err)
+	}
+
+	got, err := svc.SetSetpoint(context.Background(), &v2.SetSetpointRequest{Setpoint: 90, OverrideReason: "boil"})
+	if err != nil || !got.Success {
+		t.Errorf("SetSetpoint with override returned: %v, %v", got, err)
+	}
+	_, err = svc.SetParameter(context.Background(), &v2.SetParameterRequest{Name: "segsp[3]", Value: 90, OverrideReason: "boil"})
+	if err != nil {
+		t.Errorf("SetParameter with override returned: %v", err)
+	}
+}